@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"math/rand"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"github.com/sauerbraten/waiter/pkg/protocol/disconnectreason"
 	"github.com/sauerbraten/waiter/pkg/protocol/role"
 	"github.com/sauerbraten/waiter/pkg/server"
+	"github.com/sauerbraten/waiter/pkg/stats"
 )
 
 var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -43,6 +45,9 @@ var (
 )
 
 func main() {
+	demoFile := flag.String("demo", "", "play back the given demo file (.dmo) to connecting clients instead of hosting games")
+	flag.Parse()
+
 	var conf *server.Config
 	err := jsonfile.ParseFile("config.json", &conf)
 	if err != nil {
@@ -69,14 +74,48 @@ func main() {
 	s, callbacks = server.New(host, conf, bm,
 		server.QueueMap,
 		server.ToggleKeepTeams,
+		server.SetShuffleMode,
+		server.ToggleAutoBalance,
 		server.ToggleCompetitiveMode,
+		server.SetOvertime,
+		server.ToggleDemoRecording,
+		server.ListArchivedDemos,
 		server.ToggleReportStats,
 		server.LookupIPs,
+		server.PrintStats,
+		server.PrintLeaderboard,
+		server.PrintRank,
+		server.PrintRating,
+		server.PrintHeadToHead,
+		server.ListRejectedHits,
 		server.SetTimeLeft,
 		server.CheckAuthStatus,
 	)
 
-	s.Empty()
+	if conf.MapCRCsFile != "" {
+		s.MapCRCs, err = server.LoadMapCRCs(conf.MapCRCsFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if conf.PlayerStatsFile != "" {
+		s.PlayerStats, err = stats.Open(conf.PlayerStatsFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if *demoFile != "" {
+		err = s.StartPlayback(*demoFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		s.Commands.Register(server.SeekPlayback)
+		s.Commands.Register(server.PausePlayback)
+	} else {
+		s.Empty()
+	}
 	s.Unsupervised()
 
 	is, infoInc = StartListeningForInfoRequests(s)
@@ -24,6 +24,8 @@ type Relay struct {
 	clientPackets          map[uint32][]byte
 
 	send map[uint32]sendFunc
+
+	record sendFunc // receives everything sent to all clients, e.g. for demo recording
 }
 
 func New() *Relay {
@@ -104,6 +106,15 @@ func (r *Relay) AddClient(cn uint32, sf sendFunc) (positions *Publisher, packets
 	return
 }
 
+// SetRecorder makes the relay pass all flushed packets to record, regardless of how many clients there are. Pass nil to
+// stop.
+func (r *Relay) SetRecorder(record sendFunc) {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+
+	r.record = record
+}
+
 func (r *Relay) RemoveClient(cn uint32) error {
 	r.μ.Lock()
 	defer r.μ.Unlock()
@@ -126,6 +137,9 @@ func (r *Relay) FlushPositionAndSend(cn uint32, p []byte) {
 	defer r.μ.Unlock()
 
 	if pos := r.positions[cn]; pos != nil {
+		if r.record != nil {
+			r.record(0, pos)
+		}
 		for _cn, send := range r.send {
 			if _cn == cn {
 				continue
@@ -135,6 +149,9 @@ func (r *Relay) FlushPositionAndSend(cn uint32, p []byte) {
 		delete(r.positions, cn)
 	}
 
+	if r.record != nil {
+		r.record(0, p)
+	}
 	for _cn, send := range r.send {
 		if _cn == cn {
 			continue
@@ -163,7 +180,7 @@ func (r *Relay) flush(packets map[uint32][]byte, prefix func(uint32, []byte) []b
 	r.μ.Lock()
 	defer r.μ.Unlock()
 
-	if len(packets) == 0 || len(r.send) < 2 {
+	if len(packets) == 0 || (len(r.send) < 2 && r.record == nil) {
 		return
 	}
 
@@ -186,6 +203,10 @@ func (r *Relay) flush(packets map[uint32][]byte, prefix func(uint32, []byte) []b
 		return
 	}
 
+	if r.record != nil {
+		r.record(channel, combined)
+	}
+
 	combined = append(combined, combined...)
 
 	offset := 0
@@ -193,6 +214,9 @@ func (r *Relay) flush(packets map[uint32][]byte, prefix func(uint32, []byte) []b
 		l := lengths[cn]
 		offset += l
 		p := combined[offset : (len(combined)/2)-l+offset]
+		if len(p) == 0 {
+			continue
+		}
 		r.send[cn](channel, p)
 	}
 
@@ -0,0 +1,160 @@
+package demo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metadata describes a recorded game. It is stored next to the demo file, in a JSON file with the same name.
+type Metadata struct {
+	File        string    `json:"file"`
+	Mode        string    `json:"mode"`
+	Map         string    `json:"map"`
+	Competitive bool      `json:"competitive"`
+	Started     time.Time `json:"started"`
+	Duration    int64     `json:"duration"` // in seconds
+	Teams       []Team    `json:"teams,omitempty"`
+	Players     []Player  `json:"players"`
+}
+
+type Team struct {
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+	Frags int    `json:"frags"`
+}
+
+type Player struct {
+	Name   string                    `json:"name"`
+	Auth   map[string]string         `json:"auth,omitempty"` // auth name by domain ("" is the global master server)
+	Team   string                    `json:"team,omitempty"`
+	Frags  int                       `json:"frags"`
+	Deaths int                       `json:"deaths"`
+	Flags  int                       `json:"flags"`
+	Kills  map[string]map[string]int `json:"kills,omitempty"` // frags of other players, by victim name and weapon name
+}
+
+// Matches reports wether the query is contained in the demo's mode, map or the name or auth name of one of its players.
+// The comparison is case-insensitive.
+func (m *Metadata) Matches(query string) bool {
+	query = strings.ToLower(query)
+	contains := func(s string) bool { return strings.Contains(strings.ToLower(s), query) }
+
+	if contains(m.Mode) || contains(m.Map) {
+		return true
+	}
+	for _, p := range m.Players {
+		if contains(p.Name) {
+			return true
+		}
+		for _, name := range p.Auth {
+			if contains(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Archive is a directory of demo files with metadata sidecars.
+type Archive struct {
+	Dir     string
+	MaxAge  time.Duration // demos older than this are deleted; 0 means no limit
+	MaxSize int64         // oldest demos are deleted until the archive is smaller than this (in bytes); 0 means no limit
+}
+
+func sidecarPath(demoPath string) string {
+	return strings.TrimSuffix(demoPath, filepath.Ext(demoPath)) + ".json"
+}
+
+// Add writes the metadata of the demo at demoPath next to it, then prunes the archive.
+func (a *Archive) Add(demoPath string, meta *Metadata) error {
+	meta.File = filepath.Base(demoPath)
+
+	data, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(sidecarPath(demoPath), data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return a.Prune()
+}
+
+// Prune deletes demos (and their metadata) that are too old, then the oldest demos until the archive is within its size
+// limit. The newest demo is never deleted.
+func (a *Archive) Prune() error {
+	demos, err := filepath.Glob(filepath.Join(a.Dir, "*.dmo"))
+	if err != nil {
+		return err
+	}
+
+	var infos []os.FileInfo
+	var total int64
+	for _, path := range demos {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+		total += info.Size()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+
+	for i := 0; i < len(infos)-1; i++ {
+		info := infos[i]
+		tooOld := a.MaxAge > 0 && time.Since(info.ModTime()) > a.MaxAge
+		tooBig := a.MaxSize > 0 && total > a.MaxSize
+		if !tooOld && !tooBig {
+			continue
+		}
+
+		path := filepath.Join(a.Dir, info.Name())
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(sidecarPath(path))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= info.Size()
+	}
+
+	return nil
+}
+
+// List returns the metadata of all demos in the archive, newest first. Demos without metadata are skipped, as are JSON
+// files that can't be read or aren't demo metadata.
+func (a *Archive) List() ([]*Metadata, error) {
+	sidecars, err := filepath.Glob(filepath.Join(a.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var metas []*Metadata
+	for _, path := range sidecars {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Printf("skipping demo metadata %s: %v", path, err)
+			continue
+		}
+		meta := &Metadata{}
+		err = json.Unmarshal(data, meta)
+		if err != nil || meta.File == "" {
+			log.Printf("skipping %s: not demo metadata", path)
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Started.After(metas[j].Started) })
+
+	return metas, nil
+}
@@ -0,0 +1,128 @@
+package demo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMetadataMatches(t *testing.T) {
+	meta := &Metadata{
+		Mode: "insta ctf",
+		Map:  "forge",
+		Players: []Player{
+			{Name: "Alice"},
+			{Name: "bob", Auth: map[string]string{"": "robert"}},
+		},
+	}
+
+	for _, test := range []struct {
+		query   string
+		matches bool
+	}{
+		{"insta", true},
+		{"CTF", true},
+		{"forg", true},
+		{"alice", true},
+		{"ROBERT", true},
+		{"effic", false},
+		{"carol", false},
+	} {
+		if got := meta.Matches(test.query); got != test.matches {
+			t.Errorf("Matches(%q) = %v, expected %v", test.query, got, test.matches)
+		}
+	}
+}
+
+// creates a demo file of the given size and age, with a metadata sidecar
+func writeTestDemo(t *testing.T, dir, name string, size int, age time.Duration) {
+	path := filepath.Join(dir, name+".dmo")
+	err := ioutil.WriteFile(path, make([]byte, size), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(sidecarPath(path), []byte(`{"file": "`+name+`.dmo"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchivePrune(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		maxAge  time.Duration
+		maxSize int64
+		kept    []string
+	}{
+		{"no limits", 0, 0, []string{"a", "b", "c"}},
+		{"max age", 90 * time.Minute, 0, []string{"b", "c"}},
+		{"max size", 0, 250, []string{"b", "c"}},
+		{"max age and size", 90 * time.Minute, 150, []string{"c"}},
+		{"newest is kept", time.Second, 10, []string{"c"}},
+	} {
+		dir, err := ioutil.TempDir("", "demos")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		writeTestDemo(t, dir, "a", 100, 2*time.Hour)
+		writeTestDemo(t, dir, "b", 100, time.Hour)
+		writeTestDemo(t, dir, "c", 100, time.Minute)
+
+		a := &Archive{Dir: dir, MaxAge: test.maxAge, MaxSize: test.maxSize}
+		err = a.Prune()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		kept, _ := filepath.Glob(filepath.Join(dir, "*.dmo"))
+		sidecars, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		if len(kept) != len(test.kept) || len(sidecars) != len(test.kept) {
+			t.Errorf("%s: %d demos and %d sidecars kept, expected %d", test.name, len(kept), len(sidecars), len(test.kept))
+			continue
+		}
+		sort.Strings(kept)
+		for i, name := range test.kept {
+			if filepath.Base(kept[i]) != name+".dmo" {
+				t.Errorf("%s: kept %s, expected %s.dmo", test.name, filepath.Base(kept[i]), name)
+			}
+		}
+	}
+}
+
+func TestArchiveListSkipsForeignFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "demos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestDemo(t, dir, "a", 10, time.Minute)
+	for name, content := range map[string]string{
+		"broken.json":  "{",
+		"foreign.json": `{"something": "else"}`,
+	} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metas, err := (&Archive{Dir: dir}).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 1 || metas[0].File != "a.dmo" {
+		t.Errorf("listed %d demos, expected only a.dmo", len(metas))
+	}
+}
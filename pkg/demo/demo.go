@@ -0,0 +1,171 @@
+// Package demo reads and writes Sauerbraten demo files (.dmo) compatible with the vanilla client.
+package demo
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/protocol"
+)
+
+const (
+	magic   = "SAUERBRATEN_DEMO"
+	version = 1
+
+	// packets longer than this are considered corrupt when reading a demo
+	maxPacketLength = 16 * 1024 * 1024
+)
+
+type header struct {
+	Magic    [16]byte
+	Version  int32
+	Protocol int32
+}
+
+// Recorder writes packets sent to clients as a gzip compressed demo. It is safe for concurrent use.
+type Recorder struct {
+	μ       sync.Mutex
+	gz      *gzip.Writer
+	started time.Time
+	err     error
+}
+
+// NewRecorder writes the demo header to w and returns a recorder writing to w.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	r := &Recorder{
+		gz:      gzip.NewWriter(w),
+		started: time.Now(),
+	}
+
+	h := header{
+		Version:  version,
+		Protocol: protocol.Version,
+	}
+	copy(h.Magic[:], magic)
+	r.write(h)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r, nil
+}
+
+// Record adds a packet sent on the given channel to the demo, timestamped with the time since recording started.
+func (r *Recorder) Record(channel uint8, payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+
+	r.μ.Lock()
+	defer r.μ.Unlock()
+
+	if r.gz == nil {
+		return
+	}
+
+	millis := int32(time.Since(r.started) / time.Millisecond)
+	r.write([]int32{millis, int32(channel), int32(len(payload))})
+	r.write(payload)
+}
+
+// Close finishes the demo, but does not close the underlying writer. Packets recorded after Close are dropped.
+func (r *Recorder) Close() error {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+
+	if r.gz == nil {
+		return r.err
+	}
+
+	err := r.gz.Close()
+	if r.err == nil {
+		r.err = err
+	}
+	r.gz = nil
+
+	return r.err
+}
+
+// write remembers the first error and skips all writes after it
+func (r *Recorder) write(v interface{}) {
+	if r.err != nil {
+		return
+	}
+	r.err = binary.Write(r.gz, binary.LittleEndian, v)
+}
+
+// Packet is a recorded packet.
+type Packet struct {
+	Millis  int32 // time since the start of the recording
+	Channel uint8
+	Data    []byte
+}
+
+// Load reads the demo file at path.
+func Load(path string) ([]Packet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Read reads all packets of a gzip compressed demo from r.
+func Read(r io.Reader) ([]Packet, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("demo: opening gzip stream: %v", err)
+	}
+	defer gz.Close()
+
+	h := header{}
+	err = binary.Read(gz, binary.LittleEndian, &h)
+	if err != nil {
+		return nil, fmt.Errorf("demo: reading header: %v", err)
+	}
+	if string(h.Magic[:]) != magic {
+		return nil, errors.New("demo: not a demo file (wrong magic)")
+	}
+	if h.Version != version || h.Protocol != protocol.Version {
+		return nil, fmt.Errorf("demo: unsupported demo version %d (protocol %d)", h.Version, h.Protocol)
+	}
+
+	var packets []Packet
+	for {
+		var meta struct {
+			Millis  int32
+			Channel int32
+			Length  int32
+		}
+		err = binary.Read(gz, binary.LittleEndian, &meta)
+		if err == io.EOF {
+			return packets, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("demo: reading packet %d: %v", len(packets), err)
+		}
+		if meta.Length < 0 || meta.Length > maxPacketLength {
+			return nil, fmt.Errorf("demo: invalid length %d of packet %d", meta.Length, len(packets))
+		}
+
+		data := make([]byte, meta.Length)
+		_, err = io.ReadFull(gz, data)
+		if err != nil {
+			return nil, fmt.Errorf("demo: reading packet %d: %v", len(packets), err)
+		}
+
+		packets = append(packets, Packet{
+			Millis:  meta.Millis,
+			Channel: uint8(meta.Channel),
+			Data:    data,
+		})
+	}
+}
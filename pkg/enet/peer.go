@@ -62,7 +62,7 @@ func (p *Peer) Send(channel uint8, payload []byte) {
 	}
 
 	flags := ^uint32(PacketFlagNoAllocate) // always allocate (safer with CGO usage below)
-	if channel == 1 {
+	if channel == 1 || channel == 2 {
 		flags = flags & PacketFlagReliabe
 	}
 
@@ -98,7 +98,9 @@ func (p *Peer) Send(channel uint8, payload []byte) {
 		nmc.TeamChatMessage,
 		nmc.Client,
 		nmc.PickupSpawn,
-		nmc.PickupAck:
+		nmc.PickupAck,
+		nmc.SendDemoList,
+		nmc.SendDemo:
 	// do nothing
 	default:
 		log.Println("sending", payload, "to", p.Address.String())
@@ -1,18 +1,476 @@
 package game
 
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/geom"
+	"github.com/sauerbraten/waiter/pkg/pausableticker"
+	"github.com/sauerbraten/waiter/pkg/protocol"
+	"github.com/sauerbraten/waiter/pkg/protocol/armour"
+	"github.com/sauerbraten/waiter/pkg/protocol/entity"
+	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+	"github.com/sauerbraten/waiter/pkg/protocol/weapon"
+)
+
+const (
+	maxBases = 100
+
+	captureRadius = 64
+	captureHeight = 24
+
+	occupyBonus        = 1
+	occupyPoints       = 1
+	occupyEnemyLimit   = 28
+	occupyNeutralLimit = 14
+
+	scoreSeconds = 10
+	ammoSeconds  = 15
+	regenSeconds = 1
+
+	maxBaseAmmo = 5
+
+	regenHealth = 10
+	regenArmour = 10
+	regenAmmo   = 20 // percent of an ammo pickup
+
+	allBasesScore = 10000
+)
+
 type CaptureMode interface {
 	TeamMode
 	Bases(*Team) []int32
+	BasesInitPacket() []interface{}
+}
+
+type base struct {
+	index       int32
+	position    *geom.Vector
+	ammoGroup   int32
+	ammoType    weapon.ID
+	owner       *Team
+	enemy       *Team
+	converted   int32
+	ammo        int32
+	captureTime int32 // seconds since the current owner captured the base
+}
+
+func (b *base) contains(pos *geom.Vector) bool {
+	d := b.position.Sub(pos)
+	return d.X()*d.X()+d.Y()*d.Y() <= captureRadius*captureRadius && -captureHeight <= d.Z() && d.Z() <= captureHeight
+}
+
+// occupy adds conversion progress for the enemy team (or removes it, if units is negative) and
+// reports wether the base was neutralized or captured.
+func (b *base) occupy(units int32) bool {
+	b.converted += units
+	if units < 0 {
+		if b.converted <= 0 {
+			b.enemy = nil
+			b.converted = 0
+		}
+		return false
+	}
+
+	limit := int32(occupyNeutralLimit)
+	if b.owner != nil {
+		limit = occupyEnemyLimit
+	}
+	if b.converted < limit {
+		return false
+	}
+
+	if b.owner != nil {
+		// neutralized, the enemy keeps converting
+		b.owner = nil
+		b.converted = 0
+		return true
+	}
+
+	b.owner = b.enemy
+	b.enemy = nil
+	b.converted = 0
+	b.ammo = 0
+	b.captureTime = 0
+	return true
+}
+
+func (b *base) addAmmo(n int32) bool {
+	if b.ammo >= maxBaseAmmo {
+		return false
+	}
+	b.ammo += n
+	if b.ammo > maxBaseAmmo {
+		b.ammo = maxBaseAmmo
+	}
+	return true
+}
+
+func teamName(t *Team) string {
+	if t == nil {
+		return ""
+	}
+	return t.Name
 }
 
 type captureMode struct {
-	teamMode
-	bases map[*Team][]int32
+	s Server
+	*teamMode
+	fiveSecondsSpawnWait
+	regen   bool
+	bases   []*base
+	ticker  *pausableticker.Ticker
+	stopped bool // set by CleanUp, so ticks queued before the ticker stopped are ignored
 }
 
-func (cm *captureMode) Bases(t *Team) []int32 {
-	if bases, ok := cm.bases[t]; ok {
-		return bases
+var (
+	_ CaptureMode    = &captureMode{}
+	_ HasTimers      = &captureMode{}
+	_ HandlesPackets = &captureMode{}
+)
+
+func newCaptureMode(s Server, keepTeams, regen bool) *captureMode {
+	m := &captureMode{
+		s:        s,
+		teamMode: withTeams(s, false, keepTeams, NewTeam("good"), NewTeam("evil")),
+		regen:    regen,
+		ticker:   pausableticker.New(1 * time.Second),
 	}
-	return nil
+
+	go func() {
+		for range m.ticker.C {
+			m.s.Synchronize(m.update)
+		}
+	}()
+
+	return m
 }
+
+func (m *captureMode) NeedsMapInfo() bool {
+	return len(m.bases) == 0
+}
+
+func (m *captureMode) HandlePacket(p *Player, packetType nmc.ID, pkt *protocol.Packet) bool {
+	switch packetType {
+	case nmc.Bases:
+		m.initBases(pkt)
+
+	case nmc.ReplenishAmmo:
+		m.replenishAmmo(p)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (m *captureMode) initBases(pkt *protocol.Packet) {
+	numBases, ok := pkt.GetInt()
+	if !ok {
+		log.Println("could not read number of bases from bases packet (packet too short):", pkt)
+		return
+	}
+
+	bases := []*base{}
+	for i := int32(0); i < numBases; i++ {
+		ammoType, ok := pkt.GetInt()
+		if !ok {
+			log.Println("could not read base ammo type from bases packet (packet too short):", pkt)
+			return
+		}
+
+		position, ok := pkt.GetVector()
+		if !ok {
+			log.Println("could not read base location from bases packet (packet too short):", pkt)
+			return
+		}
+		position = position.Mul(1 / geom.DMF)
+
+		if len(bases) >= maxBases {
+			continue
+		}
+
+		bases = append(bases, newBase(int32(len(bases)), ammoType, position, bases))
+	}
+
+	if len(m.bases) != 0 {
+		log.Println("got bases packet, but bases are already initialized")
+		return
+	}
+
+	m.bases = bases
+	m.s.Broadcast(nmc.Bases, m.BasesInitPacket()...)
+}
+
+func newBase(index, ammoType int32, position *geom.Vector, others []*base) *base {
+	b := &base{
+		index:    index,
+		position: position,
+	}
+
+	if weapon.ID(ammoType) >= weapon.Shotgun && weapon.ID(ammoType) <= weapon.Pistol {
+		b.ammoType = weapon.ID(ammoType)
+		return b
+	}
+
+	if ammoType < 0 {
+		// bases in the same ammo group hand out the same ammo
+		b.ammoGroup = ammoType
+		for _, other := range others {
+			if other.ammoGroup == b.ammoGroup {
+				b.ammoType = other.ammoType
+				return b
+			}
+		}
+	}
+
+	b.ammoType = weapon.ID(rng.Int31n(int32(weapon.GrenadeLauncher)) + 1) // shotgun to grenade launcher
+	return b
+}
+
+func (m *captureMode) BasesInitPacket() []interface{} {
+	q := []interface{}{len(m.bases)}
+	for _, b := range m.bases {
+		q = append(q, teamName(b.owner), teamName(b.enemy), b.converted, b.ammo)
+	}
+	return q
+}
+
+func (m *captureMode) sendBaseInfo(b *base) {
+	var converted, ammo int32
+	if b.enemy != nil {
+		converted = b.converted
+	}
+	if b.owner != nil {
+		ammo = b.ammo
+	}
+	m.s.Broadcast(nmc.BaseInfo, b.index, teamName(b.owner), teamName(b.enemy), converted, ammo)
+}
+
+func (m *captureMode) Bases(t *Team) []int32 {
+	owned := []int32{}
+	for _, b := range m.bases {
+		if b.owner == t {
+			owned = append(owned, b.index)
+		}
+	}
+	return owned
+}
+
+// counts the alive players of each team inside the base
+func (m *captureMode) occupants(b *base) map[*Team]int32 {
+	n := map[*Team]int32{}
+	m.s.ForEachPlayer(func(p *Player) {
+		if p.State != playerstate.Alive || p.Team == NoTeam || p.Position == nil || !b.contains(p.Position) {
+			return
+		}
+		n[p.Team]++
+	})
+	return n
+}
+
+// called once per second while the game is running, on the server's main loop
+func (m *captureMode) update() {
+	if m.stopped || len(m.bases) == 0 {
+		return
+	}
+
+	if m.checkAllBasesOwned() {
+		return
+	}
+
+	for _, b := range m.bases {
+		occupants := m.occupants(b)
+
+		if b.enemy == nil {
+			// the team with the most players inside starts converting the base
+			for team, n := range occupants {
+				if team != b.owner && n > occupants[b.enemy] {
+					b.enemy = team
+					b.converted = 0
+				}
+			}
+		}
+
+		if b.enemy != nil {
+			owners, enemies := occupants[b.owner], occupants[b.enemy]
+			if owners == 0 || enemies == 0 {
+				units := -occupyBonus - occupyPoints*(1+owners)
+				if enemies > 0 {
+					units = occupyBonus + occupyPoints*enemies
+				}
+				b.occupy(units)
+			}
+			m.sendBaseInfo(b)
+		} else if b.owner != nil {
+			b.captureTime++
+
+			if b.captureTime%scoreSeconds == 0 {
+				m.addScore(b, 1)
+			}
+
+			if m.regen {
+				if b.captureTime%regenSeconds == 0 {
+					m.regenOwners(b)
+				}
+			} else if b.captureTime%ammoSeconds == 0 && b.addAmmo(1) {
+				m.sendBaseInfo(b)
+			}
+		}
+	}
+}
+
+func (m *captureMode) addScore(b *base, n int) {
+	b.owner.Score += n
+	m.s.Broadcast(nmc.BaseScore, b.index, b.owner.Name, b.owner.Score)
+	m.s.ScoreChanged()
+}
+
+// ends the game when one team owns all bases
+func (m *captureMode) checkAllBasesOwned() bool {
+	var owner *Team
+	for _, b := range m.bases {
+		if b.owner == nil || (owner != nil && b.owner != owner) {
+			return false
+		}
+		owner = b.owner
+	}
+
+	owner.Score = allBasesScore
+	m.s.Broadcast(nmc.BaseScore, -1, owner.Name, owner.Score)
+	m.s.Broadcast(nmc.ServerMessage, fmt.Sprintf("team %s captured all bases", owner.Name))
+	m.s.Intermission()
+	return true
+}
+
+func (m *captureMode) regenOwners(b *base) {
+	min := func(a, b int32) int32 {
+		if a < b {
+			return a
+		}
+		return b
+	}
+
+	maxArmour := entity.Pickups[entity.PickupGreenArmour].MaxAmount
+
+	m.s.ForEachPlayer(func(p *Player) {
+		if p.State != playerstate.Alive || p.Team != b.owner || p.Position == nil || !b.contains(p.Position) {
+			return
+		}
+
+		regenerated := false
+
+		if p.Health < p.MaxHealth {
+			p.Health = min(p.Health+regenHealth, p.MaxHealth)
+			regenerated = true
+		}
+
+		if p.ArmourType != armour.Green || p.Armour < maxArmour {
+			if p.ArmourType != armour.Green {
+				p.ArmourType = armour.Green
+				p.Armour = 0
+			}
+			p.Armour = min(p.Armour+regenArmour, maxArmour)
+			regenerated = true
+		}
+
+		// bases regenerate the ammo they would hand out in regular capture
+		wpn := b.ammoType
+		pickup := entity.Pickups[entity.ID(wpn)+7]
+		if p.Ammo[wpn] < pickup.MaxAmount {
+			amount := pickup.Amount * regenAmmo / 100
+			if amount < 1 {
+				amount = 1
+			}
+			p.Ammo[wpn] = min(p.Ammo[wpn]+amount, pickup.MaxAmount)
+			regenerated = true
+		}
+
+		if regenerated {
+			m.s.Broadcast(nmc.BaseRegen, p.CN, p.Health, p.Armour, wpn, p.Ammo[wpn])
+		}
+	})
+}
+
+// hands out ammo from an owned base the player is standing in
+func (m *captureMode) replenishAmmo(p *Player) {
+	if m.regen || p.State != playerstate.Alive || p.Position == nil {
+		return
+	}
+
+	for _, b := range m.bases {
+		if b.owner != p.Team || b.ammo <= 0 || !b.contains(p.Position) {
+			continue
+		}
+
+		pickup := &timedPickup{Pickup: entity.Pickups[entity.ID(b.ammoType)+7]}
+		if !p.CanPickup(pickup) {
+			continue
+		}
+
+		b.ammo--
+		m.sendBaseInfo(b)
+		m.s.Broadcast(nmc.ReplenishAmmo, p.CN, b.ammoType)
+		p.Pickup(pickup)
+		return
+	}
+}
+
+func (m *captureMode) Pause() {
+	m.ticker.Pause()
+}
+
+func (m *captureMode) Resume() {
+	m.ticker.Resume()
+}
+
+func (m *captureMode) CleanUp() {
+	m.stopped = true
+	m.ticker.Stop()
+}
+
+type Capture struct {
+	captureSpawnState
+	*captureMode
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode        = &Capture{}
+	_ HasTimers   = &Capture{}
+	_ TeamMode    = &Capture{}
+	_ CaptureMode = &Capture{}
+)
+
+func NewCapture(s Server, keepTeams bool) *Capture {
+	return &Capture{
+		captureMode: newCaptureMode(s, keepTeams, false),
+	}
+}
+
+func (*Capture) ID() gamemode.ID { return gamemode.Capture }
+
+type RegenCapture struct {
+	ffaSpawnState
+	*captureMode
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode        = &RegenCapture{}
+	_ HasTimers   = &RegenCapture{}
+	_ TeamMode    = &RegenCapture{}
+	_ CaptureMode = &RegenCapture{}
+)
+
+func NewRegenCapture(s Server, keepTeams bool) *RegenCapture {
+	return &RegenCapture{
+		captureMode: newCaptureMode(s, keepTeams, true),
+	}
+}
+
+func (*RegenCapture) ID() gamemode.ID { return gamemode.RegenCapture }
@@ -3,6 +3,8 @@ package game
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/sauerbraten/timer"
@@ -20,23 +22,111 @@ type Clock interface {
 	TimeLeft() time.Duration
 	SetTimeLeft(time.Duration)
 	Leave(*Player)
+	ScoreChanged()
 	CleanUp()
 }
 
+// during sudden death, the clock is extended in steps of this duration until the tie is broken
+const suddenDeathStep = 1 * time.Minute
+
+// Overtime configures how a game is decided that is tied when the clock runs out.
+type Overtime struct {
+	SuddenDeath bool          // the game goes on until the tie is broken by a frag or score
+	Duration    time.Duration // the game is extended by this duration (repeatedly, as long as it is tied)
+}
+
+func ParseOvertime(s string) (Overtime, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "off", "none":
+		return Overtime{}, nil
+	case "suddendeath", "sudden death", "goldengoal", "golden goal":
+		return Overtime{SuddenDeath: true}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return Overtime{}, err
+	}
+	if d < 0 {
+		return Overtime{}, fmt.Errorf("negative overtime duration: %s", d)
+	}
+	return Overtime{Duration: d}, nil
+}
+
+func (o Overtime) Enabled() bool { return o.SuddenDeath || o.Duration > 0 }
+
+func (o Overtime) String() string {
+	switch {
+	case o.SuddenDeath:
+		return "sudden death"
+	case o.Duration > 0:
+		return o.Duration.String()
+	default:
+		return "off"
+	}
+}
+
 type casualClock struct {
-	s          Server
-	t          *timer.Timer
-	modeTimers HasTimers
+	s           Server
+	t           *timer.Timer
+	mode        Mode
+	overtime    Overtime
+	suddenDeath bool
+	stopped     bool
 }
 
 var _ Clock = &casualClock{}
 
-func NewCasualClock(s Server, m HasTimers) *casualClock {
-	return &casualClock{
-		s:          s,
-		t:          timer.AfterFunc(s.GameDuration(), s.Intermission),
-		modeTimers: m,
+func NewCasualClock(s Server, m Mode, overtime Overtime) *casualClock {
+	c := &casualClock{
+		s:        s,
+		mode:     m,
+		overtime: overtime,
+	}
+	c.t = timer.AfterFunc(s.GameDuration(), c.timeUp)
+	return c
+}
+
+// called by the game timer, in its own goroutine
+func (c *casualClock) timeUp() {
+	c.s.Synchronize(c.endOrExtend)
+}
+
+// ends the game, or extends it if it is tied and overtime is enabled
+func (c *casualClock) endOrExtend() {
+	if c.stopped {
+		// the game already ended while this call was waiting for the main loop
+		return
+	}
+
+	if !c.overtime.Enabled() || !tied(c.mode, c.s) {
+		c.s.Intermission()
+		return
+	}
+
+	d := c.overtime.Duration
+	if c.overtime.SuddenDeath {
+		d = suddenDeathStep
+		if !c.suddenDeath {
+			c.suddenDeath = true
+			c.s.Broadcast(nmc.ServerMessage, "the game is tied: sudden death! the next score wins")
+		}
+	} else {
+		c.s.Broadcast(nmc.ServerMessage, fmt.Sprintf("the game is tied: %s overtime", d))
 	}
+
+	log.Println("game is tied, extending game timer by", d)
+	c.t = timer.AfterFunc(d, c.timeUp)
+	go c.t.Start()
+	c.s.Broadcast(nmc.TimeLeft, int32(d/time.Second))
+}
+
+// ScoreChanged ends the game if it is in sudden death and the tie was broken.
+func (c *casualClock) ScoreChanged() {
+	if !c.suddenDeath || c.Ended() || tied(c.mode, c.s) {
+		return
+	}
+	c.s.Broadcast(nmc.ServerMessage, "the tie was broken")
+	c.s.Intermission()
 }
 
 func (c *casualClock) Start() {
@@ -55,7 +145,8 @@ func (c *casualClock) Pause(p *Player) {
 	}
 	c.s.Broadcast(nmc.PauseGame, 1, cn)
 	c.t.Pause()
-	c.modeTimers.Pause()
+	c.mode.Pause()
+	c.s.ForEachPlayer(func(p *Player) { p.pauseTimers() })
 }
 
 func (c *casualClock) Paused() bool {
@@ -72,7 +163,8 @@ func (c *casualClock) Resume(p *Player) {
 	}
 	c.s.Broadcast(nmc.PauseGame, 0, cn)
 	c.t.Start()
-	c.modeTimers.Resume()
+	c.mode.Resume()
+	c.s.ForEachPlayer(func(p *Player) { p.resumeTimers() })
 }
 
 func (c *casualClock) Leave(*Player) {}
@@ -81,6 +173,8 @@ func (c *casualClock) Stop() {
 	c.s.Broadcast(nmc.TimeLeft, 0)
 	log.Println("stopping game timer, time left:", c.t.TimeLeft())
 	c.t.Stop()
+	c.stopped = true
+	c.mode.Pause() // freeze mode timers during intermission
 }
 
 func (c *casualClock) Ended() bool {
@@ -101,7 +195,7 @@ func (c *casualClock) SetTimeLeft(d time.Duration) {
 
 func (c *casualClock) CleanUp() {
 	c.t.Stop()
-	c.modeTimers.CleanUp()
+	c.mode.CleanUp()
 }
 
 type Competitive interface {
@@ -120,9 +214,9 @@ var (
 	_ Competitive = &competitiveClock{}
 )
 
-func NewCompetitiveClock(s Server, m HasTimers) *competitiveClock {
+func NewCompetitiveClock(s Server, m Mode, overtime Overtime) *competitiveClock {
 	return &competitiveClock{
-		casualClock:    NewCasualClock(s, m),
+		casualClock:    NewCasualClock(s, m, overtime),
 		mapLoadPending: map[*Player]struct{}{},
 	}
 }
@@ -203,3 +297,31 @@ func (c *competitiveClock) CleanUp() {
 }
 
 func (c *competitiveClock) ToCasual() *casualClock { return c.casualClock }
+
+// tied reports wether there is no single leader: in team modes, the best teams have the same score (or number of
+// frags in deathmatch modes), otherwise, the best players have the same number of frags.
+func tied(m Mode, s Server) bool {
+	scores := []int{}
+
+	if tm, ok := m.(TeamMode); ok {
+		_, flags := m.(FlagMode)
+		_, capture := m.(CaptureMode)
+		_, collect := m.(CollectMode)
+		tm.ForEachTeam(func(t *Team) {
+			if flags || capture || collect {
+				scores = append(scores, t.Score)
+			} else {
+				scores = append(scores, t.Frags)
+			}
+		})
+	} else {
+		s.ForEachPlayer(func(p *Player) {
+			if p.State != playerstate.Spectator {
+				scores = append(scores, p.Frags)
+			}
+		})
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+	return len(scores) >= 2 && scores[0] == scores[1]
+}
@@ -0,0 +1,432 @@
+package game
+
+import (
+	"log"
+	"time"
+
+	"github.com/sauerbraten/timer"
+
+	"github.com/sauerbraten/waiter/pkg/geom"
+	"github.com/sauerbraten/waiter/pkg/protocol"
+	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+)
+
+const (
+	collectScoreLimit = 50
+	tokenExpiry       = 10 * time.Second
+
+	// generous, to allow for lag between the client touching something and the server receiving its position
+	tokenTouchDistance = 64
+	baseTouchDistance  = 64
+)
+
+type CollectMode interface {
+	TeamMode
+	TokensInitPacket() []interface{}
+}
+
+type collectBase struct {
+	index    int32
+	team     *Team
+	position *geom.Vector
+}
+
+type token struct {
+	id            int32
+	teamID        int32 // team of the player who dropped the token as a skull of their own
+	yaw           int32
+	position      *geom.Vector
+	pendingExpiry *timer.Timer
+}
+
+type collectMode struct {
+	s Server
+	*teamMode
+	fiveSecondsSpawnWait
+	good        *Team
+	evil        *Team
+	bases       []*collectBase
+	tokens      map[int32]*token
+	nextTokenID int32
+	carried     map[*Player]int32 // player → number of enemy tokens
+}
+
+var (
+	_ CollectMode    = &collectMode{}
+	_ HasTimers      = &collectMode{}
+	_ HandlesPackets = &collectMode{}
+)
+
+func newCollectMode(s Server, keepTeams bool) *collectMode {
+	good, evil := NewTeam("good"), NewTeam("evil")
+	return &collectMode{
+		s:        s,
+		teamMode: withTeams(s, false, keepTeams, good, evil),
+		good:     good,
+		evil:     evil,
+		tokens:   map[int32]*token{},
+		carried:  map[*Player]int32{},
+	}
+}
+
+func (m *collectMode) teamByID(i int32) *Team {
+	switch i {
+	case 1:
+		return m.good
+	case 2:
+		return m.evil
+	default:
+		return nil
+	}
+}
+
+func (m *collectMode) teamID(t *Team) int32 {
+	switch t {
+	case m.good:
+		return 1
+	case m.evil:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func (m *collectMode) NeedsMapInfo() bool {
+	return len(m.bases) == 0
+}
+
+func (m *collectMode) HandlePacket(p *Player, packetType nmc.ID, pkt *protocol.Packet) bool {
+	switch packetType {
+	case nmc.InitTokens:
+		m.initBases(pkt)
+
+	case nmc.TakeToken:
+		m.takeToken(p, pkt)
+
+	case nmc.DepositTokens:
+		m.depositTokens(p, pkt)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (m *collectMode) initBases(pkt *protocol.Packet) {
+	numBases, ok := pkt.GetInt()
+	if !ok {
+		log.Println("could not read number of bases from inittokens packet (packet too short):", pkt)
+		return
+	}
+
+	bases := []*collectBase{}
+	for i := int32(0); i < numBases; i++ {
+		teamID, ok := pkt.GetInt()
+		if !ok {
+			log.Println("could not read base team from inittokens packet (packet too short):", pkt)
+			return
+		}
+
+		position, ok := pkt.GetVector()
+		if !ok {
+			log.Println("could not read base location from inittokens packet (packet too short):", pkt)
+			return
+		}
+		position = position.Mul(1 / geom.DMF)
+
+		bases = append(bases, &collectBase{
+			index:    i,
+			team:     m.teamByID(teamID),
+			position: position,
+		})
+	}
+
+	if len(m.bases) != 0 {
+		log.Println("got inittokens packet, but bases are already initialized")
+		return
+	}
+
+	m.bases = bases
+}
+
+func (m *collectMode) takeToken(p *Player, pkt *protocol.Packet) {
+	id, ok := pkt.GetInt()
+	if !ok {
+		log.Println("could not read token ID from taketoken packet (packet too short):", pkt)
+		return
+	}
+
+	if p.State != playerstate.Alive {
+		return
+	}
+
+	t, ok := m.tokens[id]
+	if !ok {
+		// another player was faster or the token expired
+		return
+	}
+	if p.Position != nil && geom.Distance(p.Position, t.position) > tokenTouchDistance {
+		log.Printf("player %d tried to take token %d from too far away", p.CN, id)
+		return
+	}
+
+	m.removeToken(t)
+	if t.teamID != m.teamID(p.Team) {
+		// enemy skull, carry it to their base
+		m.carried[p]++
+	}
+	// else: own skull, denied
+
+	m.s.Broadcast(nmc.TakeToken, p.CN, id, m.carried[p])
+}
+
+func (m *collectMode) depositTokens(p *Player, pkt *protocol.Packet) {
+	i, ok := pkt.GetInt()
+	if !ok {
+		log.Println("could not read base index from deposittokens packet (packet too short):", pkt)
+		return
+	}
+
+	if p.State != playerstate.Alive || m.carried[p] <= 0 {
+		return
+	}
+	if i < 0 || len(m.bases) <= int(i) {
+		log.Printf("base index %d from deposittokens packet out of range [0..%d]", i, len(m.bases))
+		return
+	}
+	b := m.bases[i]
+	if b.team == nil || b.team == p.Team {
+		return
+	}
+	if p.Position != nil && geom.Distance(p.Position, b.position) > baseTouchDistance {
+		log.Printf("player %d tried to deposit tokens at base %d from too far away", p.CN, i)
+		return
+	}
+
+	deposited := m.carried[p]
+	delete(m.carried, p)
+	p.Flags += int(deposited)
+	p.Team.Score += int(deposited)
+	m.s.Broadcast(nmc.DepositTokens, p.CN, b.index, deposited, m.teamID(p.Team), p.Team.Score, p.Flags)
+
+	if p.Team.Score >= collectScoreLimit {
+		m.s.Intermission()
+	}
+	m.s.ScoreChanged()
+}
+
+func (m *collectMode) addToken(teamID int32, position *geom.Vector) *token {
+	t := &token{
+		id:       m.nextTokenID,
+		teamID:   teamID,
+		yaw:      rng.Int31n(360),
+		position: position,
+	}
+	m.nextTokenID++
+
+	t.pendingExpiry = timer.AfterFunc(tokenExpiry, func() {
+		m.s.Synchronize(func() {
+			if m.tokens[t.id] != t {
+				// picked up or cleaned up in the meantime
+				return
+			}
+			delete(m.tokens, t.id)
+			m.s.Broadcast(nmc.ExpireTokens, t.id, -1)
+		})
+	})
+	t.pendingExpiry.Start()
+
+	m.tokens[t.id] = t
+	return t
+}
+
+func (m *collectMode) removeToken(t *token) {
+	t.pendingExpiry.Stop()
+	delete(m.tokens, t.id)
+}
+
+// drops the player's own skull and, unless penalized, all enemy skulls the player was carrying
+func (m *collectMode) dropTokens(p *Player, penalty bool) {
+	carried := m.carried[p]
+	delete(m.carried, p)
+
+	teamID := m.teamID(p.Team)
+	if len(m.bases) == 0 || teamID == 0 || p.Position == nil {
+		return
+	}
+
+	q := []interface{}{p.CN, p.Position.Mul(geom.DMF)}
+
+	drop := func(teamID int32) {
+		t := m.addToken(teamID, p.Position)
+		q = append(q, t.id, t.teamID, t.yaw)
+	}
+
+	drop(teamID)
+	if !penalty {
+		enemyTeamID := 3 - teamID
+		for i := int32(0); i < carried; i++ {
+			drop(enemyTeamID)
+		}
+	}
+
+	q = append(q, -1)
+	m.s.Broadcast(nmc.DropTokens, q...)
+}
+
+func (m *collectMode) TokensInitPacket() []interface{} {
+	q := []interface{}{m.good.Score, m.evil.Score, len(m.tokens)}
+
+	for _, t := range m.tokens {
+		q = append(q, t.id, t.teamID, t.yaw, t.position.Mul(geom.DMF))
+	}
+
+	for p, n := range m.carried {
+		q = append(q, p.CN, n)
+	}
+
+	return append(q, -1)
+}
+
+func (m *collectMode) HandleFrag(actor, victim *Player) {
+	if victim.State == playerstate.Alive {
+		m.dropTokens(victim, actor == victim || actor.Team == victim.Team)
+	}
+	m.teamMode.HandleFrag(actor, victim)
+}
+
+func (m *collectMode) ChangeTeam(p *Player, newTeamName string, forced bool) {
+	if _, ok := m.teamsByName[newTeamName]; ok && p.State == playerstate.Alive {
+		m.dropTokens(p, true)
+	}
+	m.teamMode.ChangeTeam(p, newTeamName, forced)
+}
+
+func (m *collectMode) Leave(p *Player) {
+	if p.State == playerstate.Alive {
+		m.dropTokens(p, false)
+	}
+	m.teamMode.Leave(p)
+}
+
+func (m *collectMode) Pause() {
+	for _, t := range m.tokens {
+		t.pendingExpiry.Pause()
+	}
+}
+
+func (m *collectMode) Resume() {
+	for _, t := range m.tokens {
+		t.pendingExpiry.Start()
+	}
+}
+
+func (m *collectMode) CleanUp() {
+	for id, t := range m.tokens {
+		t.pendingExpiry.Stop()
+		delete(m.tokens, id)
+	}
+}
+
+type Collect struct {
+	ctfSpawnState
+	*collectMode
+	*handlesPickups
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode        = &Collect{}
+	_ HasTimers   = &Collect{}
+	_ TeamMode    = &Collect{}
+	_ CollectMode = &Collect{}
+	_ PickupMode  = &Collect{}
+)
+
+func NewCollect(s Server, keepTeams bool) *Collect {
+	return &Collect{
+		collectMode:    newCollectMode(s, keepTeams),
+		handlesPickups: handlingPickups(s),
+	}
+}
+
+func (m *Collect) NeedsMapInfo() bool {
+	return m.handlesPickups.NeedsMapInfo() || m.collectMode.NeedsMapInfo()
+}
+
+func (m *Collect) HandlePacket(p *Player, packetType nmc.ID, pkt *protocol.Packet) bool {
+	switch packetType {
+	case nmc.InitTokens,
+		nmc.TakeToken,
+		nmc.DepositTokens:
+		return m.collectMode.HandlePacket(p, packetType, pkt)
+	case nmc.PickupList,
+		nmc.PickupTry:
+		return m.handlesPickups.HandlePacket(p, packetType, pkt)
+	default:
+		log.Println("received unrelated packet", packetType, pkt)
+		return false
+	}
+}
+
+func (m *Collect) Pause() {
+	m.collectMode.Pause()
+	m.handlesPickups.Pause()
+}
+
+func (m *Collect) Resume() {
+	m.collectMode.Resume()
+	m.handlesPickups.Resume()
+}
+
+func (m *Collect) CleanUp() {
+	m.collectMode.CleanUp()
+	m.handlesPickups.CleanUp()
+}
+
+func (*Collect) ID() gamemode.ID { return gamemode.Collect }
+
+type InstaCollect struct {
+	instaSpawnState
+	*collectMode
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode        = &InstaCollect{}
+	_ HasTimers   = &InstaCollect{}
+	_ TeamMode    = &InstaCollect{}
+	_ CollectMode = &InstaCollect{}
+)
+
+func NewInstaCollect(s Server, keepTeams bool) *InstaCollect {
+	return &InstaCollect{
+		collectMode: newCollectMode(s, keepTeams),
+	}
+}
+
+func (*InstaCollect) ID() gamemode.ID { return gamemode.InstaCollect }
+
+type EfficCollect struct {
+	efficSpawnState
+	*collectMode
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode        = &EfficCollect{}
+	_ HasTimers   = &EfficCollect{}
+	_ TeamMode    = &EfficCollect{}
+	_ CollectMode = &EfficCollect{}
+)
+
+func NewEfficCollect(s Server, keepTeams bool) *EfficCollect {
+	return &EfficCollect{
+		collectMode: newCollectMode(s, keepTeams),
+	}
+}
+
+func (*EfficCollect) ID() gamemode.ID { return gamemode.EfficCollect }
@@ -3,6 +3,7 @@ package game
 import (
 	"log"
 
+	"github.com/sauerbraten/waiter/pkg/ogz"
 	"github.com/sauerbraten/waiter/pkg/protocol"
 	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
 	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
@@ -32,11 +33,12 @@ type CTF struct {
 
 // assert interface implementations at compile time
 var (
-	_ Mode       = &CTF{}
-	_ HasTimers  = &CTF{}
-	_ TeamMode   = &CTF{}
-	_ FlagMode   = &CTF{}
-	_ PickupMode = &CTF{}
+	_ Mode            = &CTF{}
+	_ HasTimers       = &CTF{}
+	_ TeamMode        = &CTF{}
+	_ FlagMode        = &CTF{}
+	_ PickupMode      = &CTF{}
+	_ MapEntitiesMode = &CTF{}
 )
 
 func NewCTF(s Server, keepTeams bool) *CTF {
@@ -50,6 +52,11 @@ func (m *CTF) NeedsMapInfo() bool {
 	return m.handlesPickups.NeedsMapInfo() || m.ctfMode.NeedsMapInfo()
 }
 
+func (m *CTF) LoadMapEntities(ents []*ogz.Entity) {
+	m.ctfMode.LoadMapEntities(ents)
+	m.handlesPickups.LoadMapEntities(ents)
+}
+
 func (m *CTF) HandlePacket(p *Player, packetType nmc.ID, pkt *protocol.Packet) bool {
 	switch packetType {
 	case nmc.InitFlags,
@@ -7,11 +7,18 @@ import (
 	"github.com/sauerbraten/timer"
 
 	"github.com/sauerbraten/waiter/pkg/geom"
+	"github.com/sauerbraten/waiter/pkg/ogz"
 	"github.com/sauerbraten/waiter/pkg/protocol"
+	"github.com/sauerbraten/waiter/pkg/protocol/entity"
 	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
 	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
 )
 
+const (
+	flagScoreLimit = 10
+	flagResetTime  = 10 * time.Second
+)
+
 type FlagMode interface {
 	NeedsMapInfo() bool
 	FlagsInitPacket() []interface{}
@@ -20,7 +27,7 @@ type FlagMode interface {
 type flagMode interface {
 	TeamMode
 	CanSpawn(*Player) bool
-	InitFlags([]*flag) bool
+	InitFlags([]*flag) ([]*flag, bool) // returns the flags to use, which may differ from the ones the client sent
 	TouchFlag(*Player, *flag)
 	DropFlag(*Player, *flag)
 	TeamByFlagTeamID(int32) *Team
@@ -32,10 +39,24 @@ type flag struct {
 	teamID        int32
 	carrier       *Player
 	version       int32
+	spawnIndex    int32
 	spawnLocation *geom.Vector
 	dropLocation  *geom.Vector
 	dropTime      time.Time
+	invisible     bool
 	pendingReset  *timer.Timer
+	pendingScore  *timer.Timer // hold modes
+	pendingUnhide *timer.Timer // protect modes
+}
+
+func (f *flag) timers() []*timer.Timer {
+	timers := []*timer.Timer{}
+	for _, t := range []*timer.Timer{f.pendingReset, f.pendingScore, f.pendingUnhide} {
+		if t != nil {
+			timers = append(timers, t)
+		}
+	}
+	return timers
 }
 
 type handlesFlags struct {
@@ -45,8 +66,9 @@ type handlesFlags struct {
 }
 
 var (
-	_ FlagMode  = &handlesFlags{}
-	_ HasTimers = &handlesFlags{}
+	_ FlagMode        = &handlesFlags{}
+	_ HasTimers       = &handlesFlags{}
+	_ MapEntitiesMode = &handlesFlags{}
 )
 
 func handlingFlags(fm flagMode) *handlesFlags {
@@ -113,7 +135,39 @@ func (m *handlesFlags) initFlags(pkt *protocol.Packet) {
 		return
 	}
 
-	ok = m.InitFlags(flags)
+	m.setFlags(flags)
+}
+
+// sets up the flags from the map file's entities, so clients can't move or invent flags
+func (m *handlesFlags) LoadMapEntities(ents []*ogz.Entity) {
+	_, isHold := m.flagMode.(*hold)
+
+	flags := []*flag{}
+	for _, e := range ents {
+		if e.Type != entity.FLAG {
+			continue
+		}
+		teamID := int32(e.Attrs[1])
+		switch {
+		case teamID == 1 || teamID == 2:
+		case isHold && teamID <= 0:
+			teamID = -1 // neutral, like clients send them in hold mode
+		default:
+			continue
+		}
+		flags = append(flags, &flag{
+			index:         int32(len(flags)),
+			team:          m.TeamByFlagTeamID(teamID),
+			teamID:        teamID,
+			spawnLocation: e.Position,
+		})
+	}
+
+	m.setFlags(flags)
+}
+
+func (m *handlesFlags) setFlags(flags []*flag) {
+	flags, ok := m.InitFlags(flags)
 	if ok {
 		m.flags = flags
 	}
@@ -161,25 +215,21 @@ func (m *handlesFlags) dropAllFlags(p *Player) {
 func (m *handlesFlags) FlagsInitPacket() []interface{} {
 	q := []interface{}{}
 
-	for _, f := range m.flags {
-		if f.team == nil {
-			log.Printf("flag with index '%d' has no team!", f.index)
-			continue
+	for teamID := int32(1); teamID <= 2; teamID++ {
+		score := 0
+		if team := m.TeamByFlagTeamID(teamID); team != nil {
+			score = team.Score
 		}
-		q = append(q, f.team.Score)
+		q = append(q, score)
 	}
 
 	q = append(q, len(m.flags))
 	for _, f := range m.flags {
-		if f == nil || f.team == nil {
-			continue
-		}
-
 		var carrierCN int32 = -1
 		if f.carrier != nil {
 			carrierCN = int32(f.carrier.CN)
 		}
-		q = append(q, f.version, 0, carrierCN, 0)
+		q = append(q, f.version, f.spawnIndex, carrierCN, f.invisible)
 		if f.carrier == nil {
 			dropped := !f.dropTime.IsZero()
 			q = append(q, dropped)
@@ -199,19 +249,21 @@ func (m *handlesFlags) HandleFrag(actor, victim *Player) {
 
 func (m *handlesFlags) Pause() {
 	for _, f := range m.flags {
-		if f == nil || f.pendingReset == nil || f.pendingReset.TimeLeft() == 0 {
-			continue
+		for _, t := range f.timers() {
+			if t.TimeLeft() > 0 {
+				t.Pause()
+			}
 		}
-		f.pendingReset.Pause()
 	}
 }
 
 func (m *handlesFlags) Resume() {
 	for _, f := range m.flags {
-		if f == nil || f.pendingReset == nil || f.pendingReset.TimeLeft() == 0 {
-			continue
+		for _, t := range f.timers() {
+			if t.TimeLeft() > 0 {
+				t.Start()
+			}
 		}
-		f.pendingReset.Start()
 	}
 }
 
@@ -222,9 +274,8 @@ func (m *handlesFlags) Leave(p *Player) {
 
 func (m *handlesFlags) CleanUp() {
 	for _, f := range m.flags {
-		if f == nil || f.pendingReset == nil {
-			continue
+		for _, t := range f.timers() {
+			t.Stop()
 		}
-		f.pendingReset.Stop()
 	}
 }
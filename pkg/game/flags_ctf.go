@@ -41,10 +41,21 @@ func (m *ctf) TeamByFlagTeamID(i int32) *Team {
 	}
 }
 
-func (m *ctf) InitFlags(flags []*flag) bool {
+func (m *ctf) flagTeamID(t *Team) int32 {
+	switch t {
+	case m.good:
+		return 1
+	case m.evil:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func (m *ctf) InitFlags(flags []*flag) ([]*flag, bool) {
 	if len(flags) != 2 {
 		log.Printf("expected 2 flags in CTF mode, but got %d", len(flags))
-		return false
+		return nil, false
 	}
 
 	for _, f := range flags {
@@ -55,13 +66,13 @@ func (m *ctf) InitFlags(flags []*flag) bool {
 			m.evilFlag = f
 		default:
 			log.Printf("flag %v can't be matched to either good or evil", f)
-			return false
+			return nil, false
 		}
 	}
 
 	m.initialized = true
 
-	return true
+	return flags, true
 }
 
 func (m *ctf) TouchFlag(p *Player, f *flag) {
@@ -72,6 +83,7 @@ func (m *ctf) TouchFlag(p *Player, f *flag) {
 		// player touches her own, dropped flag
 		f.pendingReset.Stop()
 		m.returnFlag(f)
+		p.FlagReturns++
 		m.s.Broadcast(nmc.ReturnFlag, p.CN, f.index, f.version)
 		return
 	} else {
@@ -93,9 +105,10 @@ func (m *ctf) TouchFlag(p *Player, f *flag) {
 		p.Team.Score++
 		f.version++
 		m.s.Broadcast(nmc.ScoreFlag, p.CN, enemyFlag.index, enemyFlag.version, f.index, f.version, 0, f.teamID, p.Team.Score, p.Flags)
-		if p.Team.Score >= 10 {
+		if p.Team.Score >= flagScoreLimit {
 			m.s.Intermission()
 		}
+		m.s.ScoreChanged()
 	}
 }
 
@@ -124,7 +137,7 @@ func (m *ctf) DropFlag(p *Player, f *flag) {
 	f.version++
 
 	m.s.Broadcast(nmc.DropFlag, p.CN, f.index, f.version, f.dropLocation.Mul(geom.DMF))
-	f.pendingReset = timer.AfterFunc(10*time.Second, func() {
+	f.pendingReset = timer.AfterFunc(flagResetTime, func() {
 		m.returnFlag(f)
 		m.s.Broadcast(nmc.ResetFlag, f.index, f.version, 0, f.teamID, f.team.Score)
 	})
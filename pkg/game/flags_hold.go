@@ -0,0 +1,137 @@
+package game
+
+import (
+	"log"
+	"time"
+
+	"github.com/sauerbraten/timer"
+
+	"github.com/sauerbraten/waiter/pkg/geom"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+)
+
+const holdTime = 20 * time.Second
+
+// in hold modes, there is a single neutral flag, spawning at one of several locations;
+// teams score by holding on to it
+type hold struct {
+	*teamMode
+	fiveSecondsSpawnWait
+	s      Server
+	good   *Team
+	evil   *Team
+	spawns []*geom.Vector
+	flag   *flag
+}
+
+var _ flagMode = &hold{}
+
+func newHold(s Server, m *teamMode, good, evil *Team) *hold {
+	return &hold{
+		s:        s,
+		teamMode: m,
+		good:     good,
+		evil:     evil,
+	}
+}
+
+func (m *hold) TeamByFlagTeamID(i int32) *Team {
+	switch i {
+	case 1:
+		return m.good
+	case 2:
+		return m.evil
+	default:
+		return nil
+	}
+}
+
+func (m *hold) flagTeamID(t *Team) int32 {
+	switch t {
+	case m.good:
+		return 1
+	case m.evil:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func (m *hold) InitFlags(flags []*flag) ([]*flag, bool) {
+	for _, f := range flags {
+		if f.team == nil {
+			m.spawns = append(m.spawns, f.spawnLocation)
+		}
+	}
+	if len(m.spawns) == 0 {
+		// map has no neutral flags, use the team flags' locations instead
+		for _, f := range flags {
+			m.spawns = append(m.spawns, f.spawnLocation)
+		}
+	}
+	if len(m.spawns) == 0 {
+		log.Println("expected at least one flag in hold mode, but got none")
+		return nil, false
+	}
+
+	m.flag = &flag{}
+	m.spawnFlag(m.flag)
+	m.s.Broadcast(nmc.ResetFlag, m.flag.index, m.flag.version, m.flag.spawnIndex, 0, 0)
+
+	return []*flag{m.flag}, true
+}
+
+// moves the flag to a random spawn location
+func (m *hold) spawnFlag(f *flag) {
+	f.spawnIndex = rng.Int31n(int32(len(m.spawns)))
+	f.spawnLocation = m.spawns[f.spawnIndex]
+	f.dropTime = time.Time{}
+	f.carrier = nil
+	f.version++
+}
+
+func (m *hold) TouchFlag(p *Player, f *flag) {
+	if f.pendingReset != nil {
+		f.pendingReset.Stop()
+		f.pendingReset = nil
+	}
+
+	f.version++
+	m.s.Broadcast(nmc.TouchFlag, p.CN, f.index, f.version)
+	f.carrier = p
+
+	f.pendingScore = timer.AfterFunc(holdTime, func() { m.scoreFlag(p, f) })
+	f.pendingScore.Start()
+}
+
+func (m *hold) scoreFlag(p *Player, f *flag) {
+	f.pendingScore = nil
+	m.spawnFlag(f)
+
+	p.Flags++
+	p.Team.Score++
+	m.s.Broadcast(nmc.ScoreFlag, p.CN, -1, -1, f.index, f.version, f.spawnIndex, m.flagTeamID(p.Team), p.Team.Score, p.Flags)
+	if p.Team.Score >= flagScoreLimit {
+		m.s.Intermission()
+	}
+	m.s.ScoreChanged()
+}
+
+func (m *hold) DropFlag(p *Player, f *flag) {
+	if f.pendingScore != nil {
+		f.pendingScore.Stop()
+		f.pendingScore = nil
+	}
+
+	f.dropLocation = p.Position
+	f.dropTime = time.Now()
+	f.carrier = nil
+	f.version++
+
+	m.s.Broadcast(nmc.DropFlag, p.CN, f.index, f.version, f.dropLocation.Mul(geom.DMF))
+	f.pendingReset = timer.AfterFunc(flagResetTime, func() {
+		m.spawnFlag(f)
+		m.s.Broadcast(nmc.ResetFlag, f.index, f.version, f.spawnIndex, 0, 0)
+	})
+	f.pendingReset.Start()
+}
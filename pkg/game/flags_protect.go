@@ -0,0 +1,62 @@
+package game
+
+import (
+	"time"
+
+	"github.com/sauerbraten/timer"
+
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+)
+
+const protectFlagHiddenTime = 5 * time.Second
+
+// protect works like CTF, except players defend their own flag by carrying it
+// and score by touching the enemy flag
+type protect struct {
+	*ctf
+}
+
+var _ flagMode = &protect{}
+
+func newProtect(s Server, m *teamMode, good, evil *Team) *protect {
+	return &protect{
+		ctf: newCTF(s, m, good, evil),
+	}
+}
+
+func (m *protect) TouchFlag(p *Player, f *flag) {
+	if p.Team == f.team {
+		// player picks up her own flag (at its base or dropped) to protect it
+		m.takeFlag(p, f)
+	} else if !f.invisible {
+		m.scoreFlag(p, f)
+	}
+}
+
+func (m *protect) scoreFlag(p *Player, f *flag) {
+	if f.pendingReset != nil {
+		f.pendingReset.Stop()
+		f.pendingReset = nil
+	}
+	m.returnFlag(f)
+	m.hideFlag(f)
+
+	p.Flags++
+	p.Team.Score++
+	m.s.Broadcast(nmc.ScoreFlag, p.CN, -1, -1, f.index, f.version, f.spawnIndex, m.flagTeamID(p.Team), p.Team.Score, p.Flags)
+	if p.Team.Score >= flagScoreLimit {
+		m.s.Intermission()
+	}
+	m.s.ScoreChanged()
+}
+
+// makes the flag untouchable for a while after someone scored with it
+func (m *protect) hideFlag(f *flag) {
+	f.invisible = true
+	m.s.Broadcast(nmc.InvisibleFlag, f.index, 1)
+	f.pendingUnhide = timer.AfterFunc(protectFlagHiddenTime, func() {
+		f.invisible = false
+		m.s.Broadcast(nmc.InvisibleFlag, f.index, 0)
+	})
+	f.pendingUnhide.Start()
+}
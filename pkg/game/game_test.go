@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/sound"
 )
 
 var (
@@ -20,32 +21,38 @@ func (s *mockServer) GameDuration() time.Duration { return 10 * time.Minute }
 
 func (s *mockServer) Broadcast(nmc.ID, ...interface{}) {}
 
+func (s *mockServer) PlaySound(*Player, sound.ID) {}
+
 func (s *mockServer) Intermission() {}
 
+func (s *mockServer) ScoreChanged() {}
+
 func (s *mockServer) ForEachPlayer(func(*Player)) {}
 
 func (s *mockServer) UniqueName(p *Player) string { return fmt.Sprintf("%v", p) }
 
 func (s *mockServer) NumberOfPlayers() int { return 5 }
 
+func (s *mockServer) Synchronize(f func()) { f() }
+
 func TestCompetitiveMode(t *testing.T) {
 	s := &mockServer{}
 
-	timing := NewCompetitiveClock(s)
-
-	var mode Mode = NewEfficCTF(s, true, timing)
+	var mode Mode = NewEfficCTF(s, true)
 
 	log.Printf("%T", mode)
 
+	var clock Clock = NewCompetitiveClock(s, mode, Overtime{})
+
 	teamed, ok := mode.(TeamMode)
 	if !ok {
 		t.Error("effic ctf is not a team mode")
 		return
 	}
 
-	_, ok = mode.(Clock)
+	_, ok = clock.(Competitive)
 	if !ok {
-		t.Error("effic ctf is not a timed mode")
+		t.Error("competitive clock is not competitive")
 		return
 	}
 
@@ -68,3 +75,27 @@ func countPlayers(tm TeamMode) (sum int) {
 	tm.ForEachTeam(func(t *Team) { sum += len(t.Players) })
 	return
 }
+
+func TestBaseOccupy(t *testing.T) {
+	good, evil := NewTeam("good"), NewTeam("evil")
+	b := &base{enemy: good}
+
+	for i := 0; i < occupyNeutralLimit-1; i++ {
+		if b.occupy(1) {
+			t.Fatal("neutral base captured before reaching the limit")
+		}
+	}
+	if !b.occupy(1) || b.owner != good || b.enemy != nil {
+		t.Fatal("neutral base not captured after reaching the limit")
+	}
+
+	b.enemy = evil
+	if b.occupy(occupyEnemyLimit) == false || b.owner != nil || b.enemy != evil {
+		t.Fatal("enemy base not neutralized after reaching the limit")
+	}
+
+	b.occupy(-occupyEnemyLimit)
+	if b.enemy != nil || b.converted != 0 {
+		t.Fatal("enemy not removed after conversion progress decayed")
+	}
+}
@@ -0,0 +1,130 @@
+package game
+
+import (
+	"log"
+
+	"github.com/sauerbraten/waiter/pkg/ogz"
+	"github.com/sauerbraten/waiter/pkg/protocol"
+	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+)
+
+type holdMode = handlesFlags
+
+func newHoldMode(s Server, keepTeams bool) *holdMode {
+	good, evil := NewTeam("good"), NewTeam("evil")
+	return handlingFlags(
+		newHold(
+			s,
+			withTeams(s, false, keepTeams, good, evil),
+			good,
+			evil,
+		),
+	)
+}
+
+type Hold struct {
+	ctfSpawnState
+	*holdMode
+	*handlesPickups
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode            = &Hold{}
+	_ HasTimers       = &Hold{}
+	_ TeamMode        = &Hold{}
+	_ FlagMode        = &Hold{}
+	_ PickupMode      = &Hold{}
+	_ MapEntitiesMode = &Hold{}
+)
+
+func NewHold(s Server, keepTeams bool) *Hold {
+	return &Hold{
+		holdMode:       newHoldMode(s, keepTeams),
+		handlesPickups: handlingPickups(s),
+	}
+}
+
+func (m *Hold) NeedsMapInfo() bool {
+	return m.handlesPickups.NeedsMapInfo() || m.holdMode.NeedsMapInfo()
+}
+
+func (m *Hold) LoadMapEntities(ents []*ogz.Entity) {
+	m.holdMode.LoadMapEntities(ents)
+	m.handlesPickups.LoadMapEntities(ents)
+}
+
+func (m *Hold) HandlePacket(p *Player, packetType nmc.ID, pkt *protocol.Packet) bool {
+	switch packetType {
+	case nmc.InitFlags,
+		nmc.TouchFlag,
+		nmc.TryDropFlag:
+		return m.holdMode.HandlePacket(p, packetType, pkt)
+	case nmc.PickupList,
+		nmc.PickupTry:
+		return m.handlesPickups.HandlePacket(p, packetType, pkt)
+	default:
+		log.Println("received unrelated packet", packetType, pkt)
+		return false
+	}
+}
+
+func (m *Hold) Pause() {
+	m.holdMode.Pause()
+	m.handlesPickups.Pause()
+}
+
+func (m *Hold) Resume() {
+	m.holdMode.Resume()
+	m.handlesPickups.Resume()
+}
+
+func (m *Hold) CleanUp() {
+	m.holdMode.CleanUp()
+	m.handlesPickups.CleanUp()
+}
+
+func (*Hold) ID() gamemode.ID { return gamemode.Hold }
+
+type EfficHold struct {
+	efficSpawnState
+	*holdMode
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode      = &EfficHold{}
+	_ HasTimers = &EfficHold{}
+	_ TeamMode  = &EfficHold{}
+	_ FlagMode  = &EfficHold{}
+)
+
+func NewEfficHold(s Server, keepTeams bool) *EfficHold {
+	return &EfficHold{
+		holdMode: newHoldMode(s, keepTeams),
+	}
+}
+
+func (*EfficHold) ID() gamemode.ID { return gamemode.EfficHold }
+
+type InstaHold struct {
+	instaSpawnState
+	*holdMode
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode      = &InstaHold{}
+	_ HasTimers = &InstaHold{}
+	_ TeamMode  = &InstaHold{}
+	_ FlagMode  = &InstaHold{}
+)
+
+func NewInstaHold(s Server, keepTeams bool) *InstaHold {
+	return &InstaHold{
+		holdMode: newHoldMode(s, keepTeams),
+	}
+}
+
+func (*InstaHold) ID() gamemode.ID { return gamemode.InstaHold }
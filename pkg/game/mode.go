@@ -3,6 +3,7 @@ package game
 import (
 	"time"
 
+	"github.com/sauerbraten/waiter/pkg/ogz"
 	"github.com/sauerbraten/waiter/pkg/protocol"
 	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
 	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
@@ -22,6 +23,12 @@ type HandlesPackets interface {
 	HandlePacket(*Player, nmc.ID, *protocol.Packet) bool
 }
 
+// MapEntitiesMode is implemented by modes that can set up their entities (pickups, flags) from the map file, instead
+// of relying on what the first client sends.
+type MapEntitiesMode interface {
+	LoadMapEntities([]*ogz.Entity)
+}
+
 type noSpawnWait struct{}
 
 func (*noSpawnWait) CanSpawn(*Player) bool { return true }
@@ -45,12 +52,15 @@ func withoutTeams(s Server) *teamlessMode {
 
 func (m *teamlessMode) HandleFrag(actor, victim *Player) {
 	victim.Die()
+	recordKill(actor, victim)
 	if actor == victim {
 		actor.Frags--
 	} else {
 		actor.Frags++
+		actor.Streak++
 	}
 	m.s.Broadcast(nmc.Died, victim.CN, actor.CN, actor.Frags, actor.Team.Frags)
+	m.s.ScoreChanged()
 }
 
 func (m *teamlessMode) Leave(*Player) {}
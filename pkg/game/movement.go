@@ -0,0 +1,121 @@
+package game
+
+import (
+	"math"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/geom"
+)
+
+// number of position updates kept per player; clients send about 30 per second
+const movementHistorySize = 64
+
+type PhysicsState int32
+
+const (
+	PhysicsFloat PhysicsState = iota
+	PhysicsFall
+	PhysicsSlide
+	PhysicsSlope
+	PhysicsFloor
+	PhysicsStepUp
+	PhysicsStepDown
+	PhysicsBounce
+)
+
+// Movement is the physics state of a player as reported in a position packet.
+type Movement struct {
+	Time             time.Time // when the server received the update
+	Position         *geom.Vector
+	Yaw, Pitch, Roll float64 // in degrees
+	Velocity         *geom.Vector
+	Falling          *geom.Vector
+	Physics          PhysicsState
+	Move, Strafe     int32 // -1, 0 or 1
+	Crouching        bool
+	InGameClip       bool
+}
+
+// MovementHistory is a ring buffer of a player's most recent movement updates.
+type MovementHistory struct {
+	updates [movementHistorySize]Movement
+	next    int
+	len     int
+}
+
+func (h *MovementHistory) Add(m Movement) {
+	h.updates[h.next] = m
+	h.next = (h.next + 1) % movementHistorySize
+	if h.len < movementHistorySize {
+		h.len++
+	}
+}
+
+func (h *MovementHistory) Len() int { return h.len }
+
+// Latest returns the most recent update, if there is one.
+func (h *MovementHistory) Latest() (Movement, bool) {
+	if h.len == 0 {
+		return Movement{}, false
+	}
+	return h.updates[(h.next-1+movementHistorySize)%movementHistorySize], true
+}
+
+// Recent returns up to n of the most recent updates, newest first.
+func (h *MovementHistory) Recent(n int) []Movement {
+	if n > h.len {
+		n = h.len
+	}
+	recent := make([]Movement, n)
+	for i := range recent {
+		recent[i] = h.updates[(h.next-1-i+movementHistorySize)%movementHistorySize]
+	}
+	return recent
+}
+
+// At returns the update received closest to t.
+func (h *MovementHistory) At(t time.Time) (Movement, bool) {
+	abs := func(d time.Duration) time.Duration {
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+
+	closest, ok := Movement{}, false
+	for _, m := range h.Recent(h.len) {
+		if !ok || abs(m.Time.Sub(t)) < abs(closest.Time.Sub(t)) {
+			closest, ok = m, true
+		}
+	}
+	return closest, ok
+}
+
+// Span returns the most recent update that is at least delay older than the latest one (to), and the most recent
+// update that is at least span older than that (from).
+func (h *MovementHistory) Span(delay, span time.Duration) (from, to Movement, ok bool) {
+	recent := h.Recent(h.len)
+	found := false
+	for _, m := range recent {
+		if !found {
+			if recent[0].Time.Sub(m.Time) >= delay {
+				to, found = m, true
+			}
+			continue
+		}
+		if to.Time.Sub(m.Time) >= span {
+			return m, to, true
+		}
+	}
+	return Movement{}, Movement{}, false
+}
+
+// HorizontalDistance returns the distance in the XY plane between the positions of two updates.
+func HorizontalDistance(a, b Movement) float64 {
+	d := a.Position.Sub(b.Position)
+	return math.Hypot(d.X(), d.Y())
+}
+
+func (h *MovementHistory) Clear() {
+	*h = MovementHistory{}
+}
@@ -6,10 +6,12 @@ import (
 	"time"
 
 	"github.com/sauerbraten/timer"
+	"github.com/sauerbraten/waiter/pkg/ogz"
 	"github.com/sauerbraten/waiter/pkg/protocol"
 	"github.com/sauerbraten/waiter/pkg/protocol/entity"
 	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
 	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+	"github.com/sauerbraten/waiter/pkg/protocol/sound"
 )
 
 type PickupMode interface {
@@ -33,7 +35,10 @@ type handlesPickups struct {
 	pickups map[int32]*timedPickup
 }
 
-var _ PickupMode = &handlesPickups{}
+var (
+	_ PickupMode      = &handlesPickups{}
+	_ MapEntitiesMode = &handlesPickups{}
+)
 
 func handlingPickups(s Server) *handlesPickups {
 	return &handlesPickups{
@@ -122,7 +127,14 @@ func (m *handlesPickups) HandlePacket(p *Player, packetType nmc.ID, pkt *protoco
 		}
 		m.spawnDelayed(pu)
 		m.s.Broadcast(nmc.PickupAck, entityID, p.CN)
-		p.Pickup(pu)
+		if pu.Typ == entity.PickupQuadDamage {
+			p.pickUpQuad(pu, func() {
+				// runs on the quad timer's goroutine
+				m.s.Synchronize(func() { m.s.PlaySound(p, sound.QuaddamageOver) })
+			})
+		} else {
+			p.Pickup(pu)
+		}
 
 	default:
 		log.Println("received unrelated packet", packetType, pkt)
@@ -156,22 +168,35 @@ func (m *handlesPickups) initPickups(pkt *protocol.Packet) {
 			return
 		}
 
-		p := &timedPickup{
-			id:     id,
-			Pickup: entity.Pickups[typ],
-		}
-		switch typ {
-		case entity.PickupGreenArmour,
-			entity.PickupYellowArmor,
-			entity.PickupBoost,
-			entity.PickupQuadDamage:
-			m.spawnDelayed(p)
-		default:
-			p.pendingSpawn = timer.NewTimer(0) // 0 time left -> treated as spawned
+		m.addPickup(id, typ)
+	}
+}
+
+// sets up the pickups from the map file's entities, so clients can't invent or move items
+func (m *handlesPickups) LoadMapEntities(ents []*ogz.Entity) {
+	for _, e := range ents {
+		if e.Type >= entity.PickupShotgun && e.Type <= entity.PickupQuadDamage {
+			m.addPickup(e.Index, e.Type)
 		}
+	}
+}
 
-		m.pickups[id] = p
+func (m *handlesPickups) addPickup(id int32, typ entity.ID) {
+	p := &timedPickup{
+		id:     id,
+		Pickup: entity.Pickups[typ],
 	}
+	switch typ {
+	case entity.PickupGreenArmour,
+		entity.PickupYellowArmor,
+		entity.PickupBoost,
+		entity.PickupQuadDamage:
+		m.spawnDelayed(p)
+	default:
+		p.pendingSpawn = timer.NewTimer(0) // 0 time left -> treated as spawned
+	}
+
+	m.pickups[id] = p
 }
 
 func (m *handlesPickups) PickupsInitPacket() []interface{} {
@@ -6,11 +6,12 @@ import (
 )
 
 type Player struct {
-	CN       uint32
-	Name     string
-	Team     *Team
-	Model    int32
-	Position *geom.Vector
+	CN        uint32
+	Name      string
+	Team      *Team
+	Model     int32
+	Position  *geom.Vector
+	Movements MovementHistory
 	PlayerState
 }
 
@@ -24,11 +25,30 @@ func NewPlayer(cn uint32) Player {
 
 func (p *Player) ApplyDamage(attacker *Player, damage int32, weapon weapon.ID, direction *geom.Vector) {
 	p.PlayerState.applyDamage(damage)
+	p.lastHitWeapon = weapon
+	p.DamageReceived += damage
 	if attacker != p && attacker.Team != p.Team {
 		attacker.Damage += damage
 	}
+}
+
+// records a frag of victim in the fragger's kills
+func recordKill(fragger, victim *Player) {
+	if fragger == victim {
+		return
+	}
+	fragger.Kills.add(victim.CN, victim.lastHitWeapon)
+}
+
+// Move records a position update of the player.
+func (p *Player) Move(m Movement) {
+	p.Position = m.Position
+	p.Movements.Add(m)
+}
 
-	// TODO quad?
+func (p *Player) Spawn() {
+	p.Movements.Clear()
+	p.PlayerState.Spawn()
 }
 
 func (p *Player) Reset() {
@@ -37,5 +57,6 @@ func (p *Player) Reset() {
 	p.Team = NoTeam
 	p.Model = -1
 	p.Position = nil
+	p.Movements.Clear()
 	p.PlayerState.Reset()
 }
@@ -36,7 +36,53 @@ type PlayerState struct {
 	Teamkills       int
 	DamagePotential int32
 	Damage          int32
+	DamageReceived  int32
 	Flags           int
+	FlagReturns     int
+	Streak          int   // frags since the last death
+	Kills           Kills // frags of other players, by victim CN and weapon
+	projectiles     projectiles
+	lastHitWeapon   weapon.ID // weapon of the last damage received
+}
+
+// Kills counts the frags of other players, by victim CN and weapon.
+type Kills map[uint32]map[weapon.ID]int
+
+func (k Kills) add(victim uint32, wpn weapon.ID) {
+	if k[victim] == nil {
+		k[victim] = map[weapon.ID]int{}
+	}
+	k[victim][wpn]++
+}
+
+// Of returns the number of frags of the given victim.
+func (k Kills) Of(victim uint32) (n int) {
+	for _, count := range k[victim] {
+		n += count
+	}
+	return
+}
+
+// Merge adds the frags counted in other.
+func (k Kills) Merge(other Kills) {
+	for victim, byWeapon := range other {
+		for wpn, n := range byWeapon {
+			if k[victim] == nil {
+				k[victim] = map[weapon.ID]int{}
+			}
+			k[victim][wpn] += n
+		}
+	}
+}
+
+// MoveVictim moves the frags of the victim with CN from to CN to, e.g. when the victim reconnected with another CN.
+func (k Kills) MoveVictim(from, to uint32) {
+	byWeapon, ok := k[from]
+	if !ok || from == to {
+		return
+	}
+	delete(k, from)
+	k.Merge(Kills{to: byWeapon})
 }
 
 func NewPlayerState() PlayerState {
@@ -61,14 +107,17 @@ func (ps *PlayerState) Spawn() {
 	ps.LifeSequence = (ps.LifeSequence + 1) % 128
 
 	ps.LastSpawnAttempt = time.Now()
+	if ps.QuadTimer != nil {
+		ps.QuadTimer.Stop()
+	}
 	ps.QuadTimer = nil
 	ps.LastShot = time.Time{}
 	ps.GunReloadEnd = time.Time{}
 }
 
 func (ps *PlayerState) SelectWeapon(id weapon.ID) (weapon.Weapon, bool) {
-	if ps.State != playerstate.Alive {
-		return weapon.ByID(weapon.Pistol), false
+	if ps.State != playerstate.Alive || id < weapon.Saw || id > weapon.Pistol || (id != weapon.Saw && ps.Ammo[id] <= 0) {
+		return ps.SelectedWeapon, false
 	}
 	ps.SelectedWeapon = weapon.ByID(id)
 	return ps.SelectedWeapon, true
@@ -124,24 +173,69 @@ func (ps *PlayerState) Pickup(p *timedPickup) {
 		ps.ArmourType = armour.Yellow
 		ps.Armour = min(ps.Armour+p.Amount, p.MaxAmount)
 	case entity.PickupQuadDamage:
-		timeLeft := ps.QuadTimer.TimeLeft()
-		newTimeLeft := time.Duration(min(int32(timeLeft)+p.Amount, p.MaxAmount))
-		if ps.QuadTimer != nil {
-			ps.QuadTimer.Stop()
-		}
-		ps.QuadTimer = timer.NewTimer(newTimeLeft)
-		go ps.QuadTimer.Start()
+		// handled by pickUpQuad, since expiry has to be announced
 	default:
 		ps.Ammo[weapon.ID(p.Typ-7)] = min(ps.Ammo[weapon.ID(p.Typ-7)]+p.Amount, p.MaxAmount)
 	}
 }
 
+// extends the player's quad damage by the pickup's amount (up to its maximum); expired is called when it runs out
+func (ps *PlayerState) pickUpQuad(p *timedPickup, expired func()) {
+	timeLeft := ps.QuadTimer.TimeLeft() + time.Duration(p.Amount)*time.Millisecond
+	if max := time.Duration(p.MaxAmount) * time.Millisecond; timeLeft > max {
+		timeLeft = max
+	}
+	if ps.QuadTimer != nil {
+		ps.QuadTimer.Stop()
+	}
+	ps.QuadTimer = timer.AfterFunc(timeLeft, expired)
+	go ps.QuadTimer.Start()
+}
+
+func (ps *PlayerState) HasQuad() bool {
+	return ps.QuadTimer.TimeLeft() > 0
+}
+
+// returns the factor damage dealt by the player is multiplied with
+func (ps *PlayerState) DamageScale() int32 {
+	if ps.HasQuad() {
+		return weapon.QuadDamageScale
+	}
+	return 1
+}
+
+// Registers a rocket or grenade fired by the player, so its explosion can be verified later.
+func (ps *PlayerState) AddProjectile(id int32, wpn weapon.Weapon) {
+	ps.projectiles.add(id, wpn)
+}
+
+// Removes the projectile, reporting wether it was still in flight and may explode.
+func (ps *PlayerState) RemoveProjectile(id int32, wpn weapon.ID) bool {
+	return ps.projectiles.remove(id, wpn)
+}
+
+// freezes timers running on the player's state while the game is paused
+func (ps *PlayerState) pauseTimers() {
+	if ps.QuadTimer != nil {
+		ps.QuadTimer.Pause()
+	}
+	ps.projectiles.pause()
+}
+
+func (ps *PlayerState) resumeTimers() {
+	if ps.QuadTimer != nil {
+		ps.QuadTimer.Start()
+	}
+	ps.projectiles.resume()
+}
+
 func (ps *PlayerState) Die() {
 	if ps.State != playerstate.Alive {
 		return
 	}
 	ps.State = playerstate.Dead
 	ps.Deaths++
+	ps.Streak = 0
 	ps.LastDeath = time.Now()
 	if ps.QuadTimer != nil {
 		ps.QuadTimer.Stop()
@@ -162,7 +256,15 @@ func (ps *PlayerState) Reset() {
 	ps.Teamkills = 0
 	ps.DamagePotential = 0
 	ps.Damage = 0
+	ps.DamageReceived = 0
 	ps.Flags = 0
+	ps.FlagReturns = 0
+	ps.Streak = 0
+	ps.Kills = Kills{}
+	if ps.projectiles == nil {
+		ps.projectiles = projectiles{}
+	}
+	ps.projectiles.clear()
 }
 
 // below are Spawn methods scoped on empty structs for embedding into game modes
@@ -211,3 +313,12 @@ func (*ctfSpawnState) Spawn(ps *PlayerState) {
 	ps.Ammo, ps.SelectedWeapon = weapon.SpawnAmmoFFA()
 	ps.Health = ps.MaxHealth
 }
+
+type captureSpawnState struct{}
+
+func (*captureSpawnState) Spawn(ps *PlayerState) {
+	ps.ArmourType = armour.Blue
+	ps.Armour = 25
+	ps.Ammo, ps.SelectedWeapon = weapon.SpawnAmmoCapture()
+	ps.Health = ps.MaxHealth
+}
@@ -0,0 +1,83 @@
+package game
+
+import (
+	"time"
+
+	"github.com/sauerbraten/timer"
+
+	"github.com/sauerbraten/waiter/pkg/protocol/weapon"
+)
+
+const (
+	// explosions are reported by the client, so they may arrive a while after the projectile's lifetime ended
+	projectileLifetimeSlack = 1 * time.Second
+
+	// rockets fly until they hit something; explosions of rockets that would have flown further than this are ignored
+	maxRocketFlightDistance = 4096
+)
+
+type projectile struct {
+	weapon   weapon.ID
+	lifetime *timer.Timer // expires when the projectile can no longer explode
+}
+
+// a player's rockets and grenades in flight, by projectile ID
+type projectiles map[int32]*projectile
+
+func projectileLifetime(wpn weapon.Weapon) time.Duration {
+	ttl := time.Duration(wpn.TimeToLive) * time.Millisecond
+	if ttl == 0 && wpn.ProjectileSpeed > 0 {
+		ttl = maxRocketFlightDistance * time.Second / time.Duration(wpn.ProjectileSpeed)
+	}
+	return ttl + projectileLifetimeSlack
+}
+
+func (pr projectiles) add(id int32, wpn weapon.Weapon) {
+	// forget projectiles that can't explode anymore
+	for _id, p := range pr {
+		if p.lifetime.TimeLeft() <= 0 {
+			delete(pr, _id)
+		}
+	}
+
+	if p, ok := pr[id]; ok {
+		p.lifetime.Stop()
+	}
+	p := &projectile{
+		weapon:   wpn.ID,
+		lifetime: timer.NewTimer(projectileLifetime(wpn)),
+	}
+	p.lifetime.Start()
+	pr[id] = p
+}
+
+// removes the projectile, reporting wether it was in flight
+func (pr projectiles) remove(id int32, wpn weapon.ID) bool {
+	p, ok := pr[id]
+	if !ok || p.weapon != wpn {
+		return false
+	}
+	delete(pr, id)
+	inFlight := p.lifetime.TimeLeft() > 0
+	p.lifetime.Stop()
+	return inFlight
+}
+
+func (pr projectiles) pause() {
+	for _, p := range pr {
+		p.lifetime.Pause()
+	}
+}
+
+func (pr projectiles) resume() {
+	for _, p := range pr {
+		p.lifetime.Start()
+	}
+}
+
+func (pr projectiles) clear() {
+	for id, p := range pr {
+		p.lifetime.Stop()
+		delete(pr, id)
+	}
+}
@@ -0,0 +1,130 @@
+package game
+
+import (
+	"log"
+
+	"github.com/sauerbraten/waiter/pkg/ogz"
+	"github.com/sauerbraten/waiter/pkg/protocol"
+	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+)
+
+type protectMode = handlesFlags
+
+func newProtectMode(s Server, keepTeams bool) *protectMode {
+	good, evil := NewTeam("good"), NewTeam("evil")
+	return handlingFlags(
+		newProtect(
+			s,
+			withTeams(s, false, keepTeams, good, evil),
+			good,
+			evil,
+		),
+	)
+}
+
+type Protect struct {
+	ctfSpawnState
+	*protectMode
+	*handlesPickups
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode            = &Protect{}
+	_ HasTimers       = &Protect{}
+	_ TeamMode        = &Protect{}
+	_ FlagMode        = &Protect{}
+	_ PickupMode      = &Protect{}
+	_ MapEntitiesMode = &Protect{}
+)
+
+func NewProtect(s Server, keepTeams bool) *Protect {
+	return &Protect{
+		protectMode:    newProtectMode(s, keepTeams),
+		handlesPickups: handlingPickups(s),
+	}
+}
+
+func (m *Protect) NeedsMapInfo() bool {
+	return m.handlesPickups.NeedsMapInfo() || m.protectMode.NeedsMapInfo()
+}
+
+func (m *Protect) LoadMapEntities(ents []*ogz.Entity) {
+	m.protectMode.LoadMapEntities(ents)
+	m.handlesPickups.LoadMapEntities(ents)
+}
+
+func (m *Protect) HandlePacket(p *Player, packetType nmc.ID, pkt *protocol.Packet) bool {
+	switch packetType {
+	case nmc.InitFlags,
+		nmc.TouchFlag,
+		nmc.TryDropFlag:
+		return m.protectMode.HandlePacket(p, packetType, pkt)
+	case nmc.PickupList,
+		nmc.PickupTry:
+		return m.handlesPickups.HandlePacket(p, packetType, pkt)
+	default:
+		log.Println("received unrelated packet", packetType, pkt)
+		return false
+	}
+}
+
+func (m *Protect) Pause() {
+	m.protectMode.Pause()
+	m.handlesPickups.Pause()
+}
+
+func (m *Protect) Resume() {
+	m.protectMode.Resume()
+	m.handlesPickups.Resume()
+}
+
+func (m *Protect) CleanUp() {
+	m.protectMode.CleanUp()
+	m.handlesPickups.CleanUp()
+}
+
+func (*Protect) ID() gamemode.ID { return gamemode.Protect }
+
+type EfficProtect struct {
+	efficSpawnState
+	*protectMode
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode      = &EfficProtect{}
+	_ HasTimers = &EfficProtect{}
+	_ TeamMode  = &EfficProtect{}
+	_ FlagMode  = &EfficProtect{}
+)
+
+func NewEfficProtect(s Server, keepTeams bool) *EfficProtect {
+	return &EfficProtect{
+		protectMode: newProtectMode(s, keepTeams),
+	}
+}
+
+func (*EfficProtect) ID() gamemode.ID { return gamemode.EfficProtect }
+
+type InstaProtect struct {
+	instaSpawnState
+	*protectMode
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode      = &InstaProtect{}
+	_ HasTimers = &InstaProtect{}
+	_ TeamMode  = &InstaProtect{}
+	_ FlagMode  = &InstaProtect{}
+)
+
+func NewInstaProtect(s Server, keepTeams bool) *InstaProtect {
+	return &InstaProtect{
+		protectMode: newProtectMode(s, keepTeams),
+	}
+}
+
+func (*InstaProtect) ID() gamemode.ID { return gamemode.InstaProtect }
@@ -4,13 +4,19 @@ import (
 	"time"
 
 	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/sound"
 )
 
 type Server interface {
 	GameDuration() time.Duration
 	Broadcast(nmc.ID, ...interface{})
+	PlaySound(*Player, sound.ID)
 	Intermission()
+	ScoreChanged()
 	ForEachPlayer(func(*Player))
 	UniqueName(*Player) string
 	NumberOfPlayers() int
+	// Synchronize runs f on the server's main loop. It is meant for timer callbacks and must not be called from the
+	// main loop itself.
+	Synchronize(f func())
 }
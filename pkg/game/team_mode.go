@@ -11,6 +11,7 @@ type TeamMode interface {
 	Teams() map[string]*Team
 	ForEachTeam(func(*Team))
 	Join(*Player)
+	Rejoin(*Player, string)
 	ChangeTeam(*Player, string, bool)
 	Leave(*Player)
 	HandleFrag(fragger, victim *Player)
@@ -65,18 +66,38 @@ func (m *teamMode) Join(p *Player) {
 	m.s.Broadcast(nmc.SetTeam, p.CN, p.Team.Name, -1)
 }
 
+// Rejoin puts a player back into the team they were in before leaving the game. If that team doesn't exist anymore,
+// the team is selected like in Join.
+func (m *teamMode) Rejoin(p *Player, teamName string) {
+	team, ok := m.teamsByName[teamName]
+	if !ok {
+		m.Join(p)
+		return
+	}
+	team.Add(p)
+	m.s.Broadcast(nmc.SetTeam, p.CN, p.Team.Name, -1)
+}
+
 func (*teamMode) Leave(p *Player) {
 	p.Team.Remove(p)
 }
 
 func (m *teamMode) HandleFrag(fragger, victim *Player) {
 	victim.Die()
+	recordKill(fragger, victim)
 	if fragger.Team == victim.Team {
 		fragger.Frags--
+		fragger.Team.Frags--
+		if fragger != victim {
+			fragger.Teamkills++
+		}
 	} else {
 		fragger.Frags++
+		fragger.Team.Frags++
+		fragger.Streak++
 	}
 	m.s.Broadcast(nmc.Died, victim.CN, fragger.CN, fragger.Frags, fragger.Team.Frags)
+	m.s.ScoreChanged()
 }
 
 func (m *teamMode) ForEachTeam(do func(t *Team)) {
@@ -111,7 +132,7 @@ func (m *teamMode) ChangeTeam(p *Player, newTeamName string, forced bool) {
 	// try existing teams first
 	for name, team := range m.teamsByName {
 		if name == newTeamName {
-			// todo: check privileges and team balance
+			// todo: check privileges (team balance is checked by the server when auto-balancing)
 			setTeam(p.Team, team)
 			return
 		}
@@ -25,6 +25,14 @@ func (v *Vector) Magnitude() float64 {
 	return math.Sqrt(v.x*v.x + v.y*v.y + v.z*v.z)
 }
 
+func (v *Vector) Add(o *Vector) *Vector {
+	return NewVector(v.x+o.x, v.y+o.y, v.z+o.z)
+}
+
+func (v *Vector) Dot(o *Vector) float64 {
+	return v.x*o.x + v.y*o.y + v.z*o.z
+}
+
 func (v *Vector) Sub(o *Vector) *Vector {
 	return NewVector(v.x-o.x, v.y-o.y, v.z-o.z)
 }
@@ -43,3 +51,45 @@ func (v *Vector) Scale(k float64) *Vector {
 func Distance(from, to *Vector) float64 {
 	return from.Sub(to).Magnitude()
 }
+
+// Returns the unit vector pointing in the direction given by yaw and pitch (both in degrees), like vecfromyawpitch()
+// in the Sauerbraten source.
+func VectorFromYawPitch(yaw, pitch float64) *Vector {
+	yaw, pitch = yaw*math.Pi/180, pitch*math.Pi/180
+	return NewVector(
+		-math.Sin(yaw)*math.Cos(pitch),
+		math.Cos(yaw)*math.Cos(pitch),
+		math.Sin(pitch),
+	)
+}
+
+// Returns the shortest distance between the line segments p1–q1 and p2–q2.
+func SegmentDistance(p1, q1, p2, q2 *Vector) float64 {
+	clamp01 := func(f float64) float64 { return math.Max(0, math.Min(1, f)) }
+
+	d1, d2, r := q1.Sub(p1), q2.Sub(p2), p1.Sub(p2)
+	a, e, f := d1.Dot(d1), d2.Dot(d2), d2.Dot(r)
+
+	var s, t float64
+	switch {
+	case a <= 1e-9 && e <= 1e-9:
+		// both segments are points
+	case a <= 1e-9:
+		t = clamp01(f / e)
+	case e <= 1e-9:
+		s = clamp01(-d1.Dot(r) / a)
+	default:
+		b, c := d1.Dot(d2), d1.Dot(r)
+		if denom := a*e - b*b; denom > 1e-9 {
+			s = clamp01((b*f - c*e) / denom)
+		}
+		t = (b*s + f) / e
+		if t < 0 {
+			t, s = 0, clamp01(-c/a)
+		} else if t > 1 {
+			t, s = 1, clamp01((b-c)/a)
+		}
+	}
+
+	return Distance(p1.Add(d1.Mul(s)), p2.Add(d2.Mul(t)))
+}
@@ -58,6 +58,9 @@ func (r *Rotation) NextMap(requested, current game.Mode, currentMap string) stri
 
 	if _, ok := requested.(game.CTFMode); ok {
 		return nextMap(r.pools.CTF)
+	} else if _, ok := requested.(game.CollectMode); ok {
+		// collect is played on CTF maps
+		return nextMap(r.pools.CTF)
 	} else if _, ok := requested.(game.CaptureMode); ok {
 		return nextMap(r.pools.Capture)
 	} else {
@@ -75,7 +78,7 @@ func (r *Rotation) InPool(mode gamemode.ID, mapp string) bool {
 		return false
 	}
 
-	if gamemode.IsCTF(mode) {
+	if gamemode.IsCTF(mode) || gamemode.IsProtect(mode) || gamemode.IsHold(mode) || gamemode.IsCollect(mode) {
 		return inPool(r.pools.CTF)
 	} else if gamemode.IsCapture(mode) {
 		return inPool(r.pools.Capture)
@@ -0,0 +1,218 @@
+// Package ogz reads the header and entities of Sauerbraten map files (.ogz).
+package ogz
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/sauerbraten/waiter/pkg/geom"
+	"github.com/sauerbraten/waiter/pkg/protocol/entity"
+)
+
+const (
+	magic = "OCTA"
+
+	// oldest and newest supported map format versions (octaheader with headersize field)
+	minVersion = 29
+	maxVersion = 33
+
+	maxEntities = 10000
+
+	// types of map variables
+	varInt    = 0
+	varFloat  = 1
+	varString = 2
+)
+
+type Header struct {
+	Version     int32
+	HeaderSize  int32
+	WorldSize   int32
+	NumEntities int32
+	NumPVS      int32
+	Lightmaps   int32
+	Blendmap    int32
+	NumVars     int32
+	NumVSlots   int32 // since version 30
+}
+
+type Entity struct {
+	Index    int32 // position in the map's entity list, used as ID in the protocol
+	Type     entity.ID
+	Position *geom.Vector
+	Attrs    [5]int16
+}
+
+type Map struct {
+	Header
+	GameIdent string
+	Entities  []*Entity
+	CRC       uint32 // CRC32 checksum of the decompressed map, as reported by clients after loading the map
+}
+
+// Load reads the map file at path.
+func Load(path string) (*Map, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Read reads a gzip compressed map from r. Only the header, map variables and entities are parsed; the rest of the
+// map (geometry, lightmaps, etc.) is only read to compute the map's CRC. If the map can be read but not parsed (e.g.
+// because of an unsupported version), the returned map has only its CRC set and the error describes the problem.
+func Read(r io.Reader) (*Map, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("ogz: opening gzip stream: %v", err)
+	}
+	defer gz.Close()
+
+	h := crc32.NewIEEE()
+	m, parseErr := parse(io.TeeReader(gz, h))
+
+	_, err = io.Copy(h, gz)
+	if err != nil {
+		return nil, fmt.Errorf("ogz: reading map file: %v", err)
+	}
+	if parseErr != nil {
+		return &Map{CRC: h.Sum32()}, parseErr
+	}
+	m.CRC = h.Sum32()
+
+	return m, nil
+}
+
+func parse(r io.Reader) (*Map, error) {
+	m := &Map{}
+	rd := &reader{r: r}
+
+	_magic := make([]byte, len(magic))
+	rd.read(_magic)
+	if rd.err == nil && string(_magic) != magic {
+		return nil, errors.New("ogz: not a map file (wrong magic)")
+	}
+
+	rd.read(&m.Version)
+	if rd.err == nil && (m.Version < minVersion || m.Version > maxVersion) {
+		return nil, fmt.Errorf("ogz: unsupported map version %d", m.Version)
+	}
+	fields := []*int32{&m.HeaderSize, &m.WorldSize, &m.NumEntities, &m.NumPVS, &m.Lightmaps, &m.Blendmap, &m.NumVars}
+	if m.Version >= 30 {
+		fields = append(fields, &m.NumVSlots)
+	}
+	for _, f := range fields {
+		rd.read(f)
+	}
+	if rd.err != nil {
+		return nil, fmt.Errorf("ogz: reading header: %v", rd.err)
+	}
+	read := int32(len(magic) + 4*(1+len(fields)))
+	if m.HeaderSize < read {
+		return nil, fmt.Errorf("ogz: invalid header size %d", m.HeaderSize)
+	}
+	rd.skip(int64(m.HeaderSize - read))
+
+	for i := int32(0); i < m.NumVars; i++ {
+		rd.skipVar()
+	}
+
+	gameIdentLen := rd.byte()
+	gameIdent := make([]byte, int(gameIdentLen)+1) // includes null terminator
+	rd.read(gameIdent)
+	m.GameIdent = string(gameIdent[:gameIdentLen])
+
+	extraEntityInfoSize := rd.uint16()
+	extrasSize := rd.uint16()
+	rd.skip(int64(extrasSize))
+
+	numTexMRU := rd.uint16()
+	rd.skip(2 * int64(numTexMRU))
+
+	if rd.err != nil {
+		return nil, fmt.Errorf("ogz: reading map variables and game data: %v", rd.err)
+	}
+
+	numEntities := m.NumEntities
+	if numEntities > maxEntities {
+		numEntities = maxEntities
+	}
+	for i := int32(0); i < numEntities; i++ {
+		var e struct {
+			Position [3]float32
+			Attrs    [5]int16
+			Type     uint8
+			Reserved uint8
+		}
+		rd.read(&e)
+		// each entity is followed by game-specific info, which has to be skipped whichever game the map was made for
+		rd.skip(int64(extraEntityInfoSize))
+		if rd.err != nil {
+			return nil, fmt.Errorf("ogz: reading entity %d: %v", i, rd.err)
+		}
+
+		m.Entities = append(m.Entities, &Entity{
+			Index:    i,
+			Type:     entity.ID(e.Type),
+			Position: geom.NewVector(float64(e.Position[0]), float64(e.Position[1]), float64(e.Position[2])),
+			Attrs:    e.Attrs,
+		})
+	}
+
+	return m, nil
+}
+
+// wraps an io.Reader to read little endian values, remembering the first error
+type reader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *reader) read(v interface{}) {
+	if r.err != nil {
+		return
+	}
+	r.err = binary.Read(r.r, binary.LittleEndian, v)
+}
+
+func (r *reader) skip(n int64) {
+	if r.err != nil || n <= 0 {
+		return
+	}
+	_, r.err = io.CopyN(ioutil.Discard, r.r, n)
+}
+
+func (r *reader) byte() (b uint8) {
+	r.read(&b)
+	return
+}
+
+func (r *reader) uint16() (i uint16) {
+	r.read(&i)
+	return
+}
+
+func (r *reader) skipVar() {
+	typ := r.byte()
+	nameLen := r.uint16()
+	r.skip(int64(nameLen))
+	switch typ {
+	case varInt, varFloat:
+		r.skip(4)
+	case varString:
+		r.skip(int64(r.uint16()))
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("unknown map variable type %d", typ)
+		}
+	}
+}
@@ -35,10 +35,16 @@ func New(d time.Duration) *Ticker {
 
 func (t *Ticker) run(c chan<- time.Time) {
 	defer close(t.stop)
+	defer close(c)
 
 	for {
 		select {
-		case c <- <-t.ticker.C:
+		case tick := <-t.ticker.C:
+			// drop the tick if the receiver is busy, so pausing and stopping never block
+			select {
+			case c <- tick:
+			default:
+			}
 		case shouldPause := <-t.pause:
 			if shouldPause {
 				t.paused = true
@@ -84,7 +90,6 @@ func (t *Ticker) Stop() {
 	defer t.Unlock()
 
 	if t.stop != nil {
-		close(t.pause)
 		t.pause = nil
 		t.stop <- struct{}{}
 		<-t.stop
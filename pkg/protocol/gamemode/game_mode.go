@@ -144,7 +144,11 @@ func Valid(gm ID) bool {
 	switch gm {
 	case FFA, Insta, Effic, Tactics,
 		Teamplay, InstaTeam, EfficTeam, TacticsTeam,
-		CTF, InstaCTF, EfficCTF:
+		CTF, InstaCTF, EfficCTF,
+		Protect, InstaProtect, EfficProtect,
+		Hold, InstaHold, EfficHold,
+		Capture, RegenCapture,
+		Collect, InstaCollect, EfficCollect:
 		return true
 	default:
 		return false
@@ -160,6 +164,24 @@ func IsCTF(gm ID) bool {
 	}
 }
 
+func IsProtect(gm ID) bool {
+	switch gm {
+	case Protect, InstaProtect, EfficProtect:
+		return true
+	default:
+		return false
+	}
+}
+
+func IsHold(gm ID) bool {
+	switch gm {
+	case Hold, InstaHold, EfficHold:
+		return true
+	default:
+		return false
+	}
+}
+
 func IsCapture(gm ID) bool {
 	switch gm {
 	case Capture, RegenCapture:
@@ -168,3 +190,12 @@ func IsCapture(gm ID) bool {
 		return false
 	}
 }
+
+func IsCollect(gm ID) bool {
+	switch gm {
+	case Collect, InstaCollect, EfficCollect:
+		return true
+	default:
+		return false
+	}
+}
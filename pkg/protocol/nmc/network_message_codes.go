@@ -73,9 +73,9 @@ const (
 	Bases
 	BaseInfo
 	BaseScore
-	REPAMMO
-	BASEREGEN
-	ANNOUNCE // 70
+	ReplenishAmmo // = REPAMMO
+	BaseRegen     // = BASEREGEN
+	ANNOUNCE      // 70
 	ListDemos
 	SendDemoList
 	GetDemo
@@ -108,16 +108,16 @@ const (
 	BOTLIMIT // 100
 	BOTBALANCE
 	MapCRC
-	CHECKMAPS
+	CheckMaps
 	ChangeName  // = SWITCHNAME
 	ChangeModel // = SWITCHMODEL
 	ChangeTeam  // = SWITCHTEAM
-	INITTOKENS
-	TAKETOKEN
-	EXPIRETOKENS
-	DROPTOKENS // 110
-	DEPOSITTOKENS
-	STEALTOKENS
+	InitTokens
+	TakeToken
+	ExpireTokens
+	DropTokens // 110
+	DepositTokens
+	StealTokens
 	ServerCommand
 	DEMOPACKET
 	//NUMMSG
@@ -147,7 +147,7 @@ var ServerOnlyNMCs = []ID{
 	PlayerStateList,
 	BaseScore,
 	BaseInfo,
-	BASEREGEN,
+	BaseRegen,
 	ANNOUNCE,
 	SendDemoList,
 	SendDemo,
@@ -161,8 +161,8 @@ var ServerOnlyNMCs = []ID{
 	Client,
 	AuthChallenge,
 	INITAI,
-	EXPIRETOKENS,
-	DROPTOKENS,
-	STEALTOKENS,
+	ExpireTokens,
+	DropTokens,
+	StealTokens,
 	DEMOPACKET,
 }
@@ -19,6 +19,27 @@ const (
 	numWeapons int32 = iota
 )
 
+func (id ID) String() string {
+	switch id {
+	case Saw:
+		return "chainsaw"
+	case Shotgun:
+		return "shotgun"
+	case Minigun:
+		return "chaingun"
+	case RocketLauncher:
+		return "rocket launcher"
+	case Rifle:
+		return "rifle"
+	case GrenadeLauncher:
+		return "grenade launcher"
+	case Pistol:
+		return "pistol"
+	default:
+		return "unknown"
+	}
+}
+
 var WeaponsWithAmmo = []ID{
 	Shotgun,
 	Minigun,
@@ -132,4 +153,5 @@ func FlattenAmmo(m map[ID]int32) (values []int32) {
 const (
 	ExplosionDistanceScale   = 1.5
 	ExplosionSelfDamageScale = 0.5
+	QuadDamageScale          = 4
 )
@@ -24,6 +24,7 @@ func (s *Server) handleAuthRequest(client *Client, domain string, name string, o
 			}
 			client.Authentications[domain].name = name
 			onSuccess(rol)
+			s.rejoinAuthenticated(client, domain, name)
 		}
 	}
 
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+)
+
+const (
+	// how long teams have to be unbalanced before a player is picked to be moved
+	balanceDelay = 15 * time.Second
+
+	// players who joined less than this long ago are moved before others
+	recentJoin = time.Minute
+)
+
+// A player picked to be moved to another team at their next death.
+type balanceMove struct {
+	c    *Client
+	team string
+}
+
+// counts the players (not spectators) in each team of the current game
+func (s *Server) teamSizes() map[string]int {
+	teamMode, ok := s.GameMode.(game.TeamMode)
+	if !ok {
+		return nil
+	}
+	sizes := map[string]int{}
+	for name := range teamMode.Teams() {
+		sizes[name] = 0
+	}
+	s.Clients.ForEach(func(c *Client) {
+		if c.Peer == nil || !c.Joined || c.State == playerstate.Spectator {
+			return
+		}
+		if _, ok := sizes[c.Team.Name]; ok {
+			sizes[c.Team.Name]++
+		}
+	})
+	return sizes
+}
+
+// returns the names of the biggest and the smallest team and the difference in size
+func imbalance(sizes map[string]int) (bigger, smaller string, diff int) {
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	if len(names) < 2 {
+		return "", "", 0
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sizes[names[i]] != sizes[names[j]] {
+			return sizes[names[i]] > sizes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	bigger, smaller = names[0], names[len(names)-1]
+	return bigger, smaller, sizes[bigger] - sizes[smaller]
+}
+
+// Reports wether the client switching to the given team would leave the teams unbalanced by two or more players, when
+// they are more balanced now.
+func (s *Server) wouldUnbalance(c *Client, teamName string) bool {
+	if c.State == playerstate.Spectator {
+		return false
+	}
+	sizes := s.teamSizes()
+	if _, ok := sizes[teamName]; !ok {
+		return false
+	}
+	_, _, before := imbalance(sizes)
+	sizes[c.Team.Name]--
+	sizes[teamName]++
+	_, _, after := imbalance(sizes)
+	return after >= 2 && after > before
+}
+
+// a captured flag counts like five frags
+func impact(c *Client) int {
+	return c.Frags + 5*c.Flags
+}
+
+// Picks the player to move out of the given team: the one who joined most recently, if someone joined recently,
+// otherwise the one with the lowest impact on the game. Players put into their team by a master are never picked.
+func (s *Server) pickBalanceCandidate(teamName string) *Client {
+	var candidates []*Client
+	s.Clients.ForEach(func(c *Client) {
+		if c.Peer != nil && c.Joined && c.State != playerstate.Spectator && c.Team.Name == teamName && !c.TeamLocked {
+			candidates = append(candidates, c)
+		}
+	})
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		aRecent, bRecent := time.Since(a.JoinTime) < recentJoin, time.Since(b.JoinTime) < recentJoin
+		switch {
+		case aRecent != bRecent:
+			return aRecent
+		case aRecent:
+			return a.JoinTime.After(b.JoinTime)
+		case impact(a) != impact(b):
+			return impact(a) < impact(b)
+		default:
+			return a.JoinTime.After(b.JoinTime)
+		}
+	})
+	return candidates[0]
+}
+
+// Cancels a pending auto-balance.
+func (s *Server) cancelBalance() {
+	if s.pendingBalance != nil {
+		s.pendingBalance.Stop()
+		s.pendingBalance = nil
+	}
+	s.balanceMove = nil
+}
+
+// Checks the team sizes after players joined, left or switched teams. When auto-balancing is enabled and the teams
+// differ in size by two or more, a player is picked to be moved after a while, unless the teams are balanced by then.
+func (s *Server) checkTeamBalance() {
+	if !s.AutoBalance || s.Playback != nil {
+		s.cancelBalance()
+		return
+	}
+
+	bigger, _, diff := imbalance(s.teamSizes())
+	if diff < 2 {
+		s.cancelBalance()
+		return
+	}
+
+	if m := s.balanceMove; m != nil && (m.c.Peer == nil || m.c.State == playerstate.Spectator || m.c.Team.Name != bigger) {
+		// the picked player left or switched teams
+		s.balanceMove = nil
+	}
+	if s.balanceMove != nil || s.pendingBalance != nil {
+		return
+	}
+
+	s.pendingBalance = time.AfterFunc(balanceDelay, func() {
+		s.callbacks <- s.balanceTeams
+	})
+}
+
+// Picks a player from the biggest team to be moved to the smallest team at their next death.
+func (s *Server) balanceTeams() {
+	s.pendingBalance = nil
+	if !s.AutoBalance || s.balanceMove != nil {
+		return
+	}
+
+	bigger, smaller, diff := imbalance(s.teamSizes())
+	if diff < 2 {
+		return
+	}
+
+	c := s.pickBalanceCandidate(bigger)
+	if c == nil {
+		return
+	}
+	s.balanceMove = &balanceMove{c: c, team: smaller}
+
+	if c.State == playerstate.Alive {
+		s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("teams are unbalanced: %s will be moved to %s after their next death",
+			s.Clients.UniqueName(c), cubecode.Blue(smaller)))
+		return
+	}
+	s.moveForBalance(c)
+}
+
+// Moves the client picked to balance the teams, if c is that client. Called when a player dies, so c can't be carrying
+// a flag anymore.
+func (s *Server) moveForBalance(c *Client) {
+	m := s.balanceMove
+	if m == nil || m.c != c {
+		return
+	}
+	teamMode, ok := s.GameMode.(game.TeamMode)
+	if !ok {
+		return
+	}
+	s.balanceMove = nil
+
+	// teams may have been balanced by others in the meantime
+	if s.wouldUnbalance(c, m.team) {
+		s.checkTeamBalance()
+		return
+	}
+
+	teamMode.ChangeTeam(&c.Player, m.team, true)
+	log.Printf("moved %s to %s to balance teams", c, m.team)
+	s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("%s was moved to %s to balance teams", s.Clients.UniqueName(c), cubecode.Blue(m.team)))
+
+	s.checkTeamBalance()
+}
+
+// Handles a frag and moves the victim to another team if its team is to be restored after reconnecting, or if it was
+// picked to balance the teams.
+func (s *Server) handleFrag(fragger, victim *Client) {
+	s.GameMode.HandleFrag(&fragger.Player, &victim.Player)
+	s.restorePendingTeam(victim)
+	s.moveForBalance(victim)
+}
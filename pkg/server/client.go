@@ -33,6 +33,16 @@ type Client struct {
 	Positions           *relay.Publisher
 	Packets             *relay.Publisher
 	Authentications     map[string]*Authentication
+	Violations          int       // number of impossible actions, e.g. shooting too fast
+	LastViolation       time.Time // when the client last did something impossible
+	SuspiciousMovements int       // number of times the client moved faster than possible
+	LastPushed          time.Time // last use of a jump pad or teleport, or push by a hit
+	RejectedHits        int       // number of hits that were geometrically impossible
+	MapCRC              uint32    // CRC of the client's map file, 0 if not reported
+	ModifiedMap         bool      // true if the client's map file differs from the server's
+	TeamLocked          bool      // true if a master put the client into its team; kept when teams are shuffled
+	JoinTime            time.Time // when the client joined the game
+	PendingTeam         string    // team to put the client back into at its next death, after reconnecting
 }
 
 func NewClient(cn uint32, peer *enet.Peer) *Client {
@@ -53,6 +63,16 @@ func (c *Client) Reset() {
 	c.Peer = nil
 	c.SessionID = rng.Int31()
 	c.Ping = 0
+	c.Violations = 0
+	c.LastViolation = time.Time{}
+	c.SuspiciousMovements = 0
+	c.LastPushed = time.Time{}
+	c.RejectedHits = 0
+	c.MapCRC = 0
+	c.ModifiedMap = false
+	c.TeamLocked = false
+	c.JoinTime = time.Time{}
+	c.PendingTeam = ""
 	if c.Positions != nil {
 		c.Positions.Close()
 	}
@@ -19,7 +19,8 @@ import (
 )
 
 type ClientManager struct {
-	cs []*Client
+	cs     []*Client
+	record func(channel uint8, payload []byte) // set while a demo is recorded
 }
 
 // Links an ENet peer to a client object. If no unused client object can be found, a new one is created and added to the global set of clients.
@@ -79,6 +80,7 @@ func (cm *ClientManager) SendToTeam(c *Client, typ nmc.ID, args ...interface{})
 
 // Sends a packet to all clients currently in use.
 func (cm *ClientManager) Broadcast(typ nmc.ID, args ...interface{}) {
+	cm.recordDemo(typ, args...)
 	cm.broadcast(nil, typ, args...)
 }
 
@@ -98,12 +100,30 @@ func exclude(c *Client) func(*Client) bool {
 }
 
 func (cm *ClientManager) Relay(from *Client, typ nmc.ID, args ...interface{}) {
+	cm.recordDemo(typ, args...)
 	cm.broadcast(exclude(from), typ, args...)
 }
 
+func (cm *ClientManager) recordDemo(typ nmc.ID, args ...interface{}) {
+	if cm.record != nil {
+		cm.record(1, packet.Encode(typ, packet.Encode(args...)))
+	}
+}
+
 // Sends 'welcome' information to a newly joined client like map, mode, time left, other players, etc.
 func (s *Server) SendWelcome(c *Client) {
-	typ, p := nmc.Welcome, []interface{}{
+	if s.Playback != nil {
+		// the recorded game's welcome packet announces the recorded map and mode
+		s.Playback.welcome(c)
+		return
+	}
+	c.Send(nmc.Welcome, s.welcomePacket(c)...)
+}
+
+// Builds the welcome packet for c. If c is nil, the packet describes the game from an observer's point of view, e.g.
+// for demos.
+func (s *Server) welcomePacket(c *Client) []interface{} {
+	p := []interface{}{
 		nmc.MapChange, s.Map, s.GameMode.ID(), s.GameMode.NeedsMapInfo(), // currently played mode & map
 	}
 
@@ -134,15 +154,17 @@ func (s *Server) SendWelcome(c *Client) {
 		p = append(p, "")
 	}
 
-	// tell the client what team he was put in by the server
-	p = append(p, nmc.SetTeam, c.CN, c.Team.Name, -1)
+	if c != nil {
+		// tell the client what team he was put in by the server
+		p = append(p, nmc.SetTeam, c.CN, c.Team.Name, -1)
 
-	// tell the client how to spawn (what health, what armour, what weapons, what ammo, etc.)
-	if c.State == playerstate.Spectator {
-		p = append(p, nmc.Spectator, c.CN, 1)
-	} else {
-		// TODO: handle spawn delay (e.g. in ctf modes)
-		p = append(p, nmc.SpawnState, c.CN, c.ToWire())
+		// tell the client how to spawn (what health, what armour, what weapons, what ammo, etc.)
+		if c.State == playerstate.Spectator {
+			p = append(p, nmc.Spectator, c.CN, 1)
+		} else {
+			// TODO: handle spawn delay (e.g. in ctf modes)
+			p = append(p, nmc.SpawnState, c.CN, c.ToWire())
+		}
 	}
 
 	// send other players' state (frags, flags, etc.)
@@ -161,7 +183,23 @@ func (s *Server) SendWelcome(c *Client) {
 		}
 	}
 
-	c.Send(typ, p...)
+	return p
+}
+
+// Sends the state of mode-specific objects like flags, bases and tokens.
+func (s *Server) sendModeState(send func(typ nmc.ID, args ...interface{})) {
+	if flagMode, ok := s.GameMode.(game.FlagMode); ok {
+		send(nmc.InitFlags, flagMode.FlagsInitPacket()...)
+	}
+	if captureMode, ok := s.GameMode.(game.CaptureMode); ok {
+		captureMode.ForEachTeam(func(t *game.Team) {
+			send(nmc.BaseScore, -1, t.Name, t.Score)
+		})
+		send(nmc.Bases, captureMode.BasesInitPacket()...)
+	}
+	if collectMode, ok := s.GameMode.(game.CollectMode); ok {
+		send(nmc.InitTokens, collectMode.TokensInitPacket()...)
+	}
 }
 
 // Tells other clients that the client disconnected, giving a disconnect reason in case it's not a normal leave.
@@ -193,6 +231,8 @@ func (cm *ClientManager) InformOthersOfJoin(c *Client) {
 func (s *Server) MapChange() {
 	s.Clients.ForEach(func(c *Client) {
 		c.Player.PlayerState.Reset()
+		c.MapCRC = 0
+		c.ModifiedMap = false
 		if c.State == playerstate.Spectator {
 			return
 		}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
+	"github.com/sauerbraten/waiter/pkg/game"
 	"github.com/sauerbraten/waiter/pkg/maprot"
 	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
 )
@@ -22,17 +24,34 @@ type _Config struct {
 	MessageOfTheDay         string       `json:"message_of_the_day"`
 	AuthDomain              string       `json:"auth_domain"`
 	MapPools                maprot.Pools `json:"maps"`
+	MapsDirectory           string       `json:"maps_directory"`
+	MapCRCsFile             string       `json:"map_crcs_file"`
+	RecordDemos             bool         `json:"record_demos"`
+	DemosDirectory          string       `json:"demos_directory"`
+	DemoRetention           int          `json:"demo_retention"`
+	DemoArchiveMaxSize      int64        `json:"demo_archive_max_size"` // in MB
+	PlayerStatsFile         string       `json:"player_stats_file"`
+	StatsMinGames           int          `json:"stats_min_games"`
+	AutoBalance             bool         `json:"auto_balance"`
+
+	ViolationLimit          int             `json:"violation_limit"`
+	ViolationAction         ViolationAction `json:"violation_action"`
+	SuspiciousMovementLimit int             `json:"suspicious_movement_limit"`
 }
 
 type Config struct {
 	_Config
-	GameDuration time.Duration
+	GameDuration      time.Duration
+	DefaultOvertime   game.Overtime
+	DemoArchiveMaxAge time.Duration
 }
 
 func (c *Config) UnmarshalJSON(data []byte) error {
 	proxy := struct {
 		_Config
 		GameDuration string `json:"game_duration"`
+		Overtime     string `json:"overtime"`
+		DemoMaxAge   string `json:"demo_archive_max_age"`
 	}{}
 	err := json.Unmarshal(data, &proxy)
 	if err != nil {
@@ -46,5 +65,24 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	c.DefaultOvertime, err = game.ParseOvertime(proxy.Overtime)
+	if err != nil {
+		return err
+	}
+
+	if proxy.DemoMaxAge != "" {
+		c.DemoArchiveMaxAge, err = time.ParseDuration(proxy.DemoMaxAge)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.ViolationAction == "" {
+		c.ViolationAction = LogViolation
+	}
+	if !c.ViolationAction.valid() {
+		return fmt.Errorf("invalid violation action '%s' (must be one of '%s', '%s', '%s')", c.ViolationAction, LogViolation, SpectateViolation, KickViolation)
+	}
+
 	return nil
 }
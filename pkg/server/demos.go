@@ -0,0 +1,303 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sauerbraten/waiter/internal/net/packet"
+	"github.com/sauerbraten/waiter/pkg/demo"
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
+	"github.com/sauerbraten/waiter/pkg/protocol/mastermode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/role"
+)
+
+// A recorded game, kept in memory so clients can download it.
+type Demo struct {
+	Recorded time.Time
+	Mode     gamemode.ID
+	Map      string
+	Data     []byte
+}
+
+// Info describes the demo the way the vanilla server does in its demo list.
+func (d *Demo) Info() string {
+	size := fmt.Sprintf("%.2fkB", float64(len(d.Data))/1024)
+	if len(d.Data) >= 1024*1024 {
+		size = fmt.Sprintf("%.2fMB", float64(len(d.Data))/(1024*1024))
+	}
+	return fmt.Sprintf("%s: %s, %s, %s", d.Recorded.Format("Mon Jan 2 15:04:05 2006"), d.Mode, d.Map, size)
+}
+
+// the demo currently being recorded
+type recording struct {
+	*demo.Recorder
+	meta        Demo
+	competitive bool
+	buf         bytes.Buffer
+	file        *os.File
+}
+
+// Starts recording the current game. The demo is kept in memory if demo retention is enabled, and written to a new file
+// in the demos directory (if one is configured) if demo recording is enabled or the game is competitive.
+func (s *Server) startDemoRecording() {
+	toFile := (s.RecordDemos || s.CompetitiveMode) && s.DemosDirectory != ""
+	if !toFile && s.DemoRetention <= 0 {
+		return
+	}
+
+	r := &recording{
+		meta: Demo{
+			Recorded: time.Now(),
+			Mode:     s.GameMode.ID(),
+			Map:      s.Map,
+		},
+		competitive: s.CompetitiveMode,
+	}
+
+	var writers []io.Writer
+	if s.DemoRetention > 0 {
+		writers = append(writers, &r.buf)
+	}
+	if toFile {
+		var err error
+		r.file, err = s.createDemoFile(&r.meta)
+		if err != nil {
+			// keep recording into memory, if demo retention is enabled
+			log.Println("could not create demo file:", err)
+		} else {
+			log.Println("recording demo to", r.file.Name())
+			writers = append(writers, r.file)
+		}
+	}
+	if len(writers) == 0 {
+		return
+	}
+
+	rec, err := demo.NewRecorder(io.MultiWriter(writers...))
+	if err != nil {
+		log.Println("could not start demo recording:", err)
+		if r.file != nil {
+			r.file.Close()
+			os.Remove(r.file.Name())
+		}
+		return
+	}
+	r.Recorder = rec
+	s.recording = r
+
+	// the demo starts with the state of the game, like a client connecting as spectator would get it
+	rec.Record(1, packet.Encode(nmc.Welcome, packet.Encode(s.welcomePacket(nil)...)))
+	s.sendModeState(func(typ nmc.ID, args ...interface{}) {
+		rec.Record(1, packet.Encode(typ, packet.Encode(args...)))
+	})
+
+	// from now on, record everything sent to all clients
+	s.Clients.record = rec.Record
+	s.relay.SetRecorder(rec.Record)
+
+	s.Clients.Broadcast(nmc.ServerMessage, "recording demo")
+}
+
+// Creates a new file for the demo in the demos directory.
+func (s *Server) createDemoFile(meta *Demo) (*os.File, error) {
+	err := os.MkdirAll(s.DemosDirectory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s_%s_%s.dmo",
+		meta.Recorded.Format("2006-01-02_15-04-05"),
+		strings.Replace(meta.Mode.String(), " ", "_", -1),
+		filepath.Base(meta.Map),
+	)
+	return os.Create(filepath.Join(s.DemosDirectory, name))
+}
+
+// Finishes the demo currently being recorded, if any, and keeps it in memory.
+func (s *Server) stopDemoRecording() {
+	r := s.recording
+	if r == nil {
+		return
+	}
+	s.recording = nil
+
+	s.relay.SetRecorder(nil)
+	s.Clients.record = nil
+
+	err := r.Close()
+	if err != nil {
+		log.Println("error finishing demo:", err)
+	}
+	if r.file != nil {
+		err = r.file.Close()
+		if err != nil {
+			log.Println("error closing demo file:", err)
+		}
+		err = s.DemoArchive.Add(r.file.Name(), s.demoMetadata(r))
+		if err != nil {
+			log.Println("error archiving demo:", err)
+		}
+	}
+
+	if s.DemoRetention <= 0 {
+		return
+	}
+	r.meta.Data = r.buf.Bytes()
+	s.Demos = append(s.Demos, &r.meta)
+	if len(s.Demos) > s.DemoRetention {
+		s.Demos = s.Demos[len(s.Demos)-s.DemoRetention:]
+	}
+	s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("demo \"%s\" recorded", r.meta.Info()))
+}
+
+// Describes the recorded game as it is at the moment (i.e. at the end of the game).
+func (s *Server) demoMetadata(r *recording) *demo.Metadata {
+	meta := &demo.Metadata{
+		Mode:        r.meta.Mode.String(),
+		Map:         r.meta.Map,
+		Competitive: r.competitive,
+		Started:     r.meta.Recorded,
+		Duration:    int64(time.Since(r.meta.Recorded) / time.Second),
+	}
+
+	if teamMode, ok := s.GameMode.(game.TeamMode); ok {
+		teamMode.ForEachTeam(func(t *game.Team) {
+			meta.Teams = append(meta.Teams, demo.Team{
+				Name:  t.Name,
+				Score: t.Score,
+				Frags: t.Frags,
+			})
+		})
+	}
+
+	// everyone in the game, including spectators (they may have played part of the game)
+	s.Clients.ForEach(func(c *Client) {
+		if !c.Joined {
+			return
+		}
+		p := demo.Player{
+			Name:   c.Name,
+			Team:   c.Team.Name,
+			Frags:  c.Frags,
+			Deaths: c.Deaths,
+			Flags:  c.Flags,
+			Kills:  s.exportKills(c.Kills),
+		}
+		for domain, a := range c.Authentications {
+			if a.name == "" {
+				continue
+			}
+			if p.Auth == nil {
+				p.Auth = map[string]string{}
+			}
+			p.Auth[domain] = a.name
+		}
+		meta.Players = append(meta.Players, p)
+	})
+
+	// players who left before the end of the game (saved states are stored under several keys)
+	var left []*savedState
+	seen := map[*savedState]bool{}
+	for _, saved := range s.savedStates {
+		if !seen[saved] {
+			seen[saved] = true
+			left = append(left, saved)
+		}
+	}
+	sort.Slice(left, func(i, j int) bool { return left[i].cn < left[j].cn })
+	for _, saved := range left {
+		p := demo.Player{
+			Name:   saved.name,
+			Team:   saved.team,
+			Frags:  saved.frags,
+			Deaths: saved.deaths,
+			Flags:  saved.flags,
+			Kills:  s.exportKills(saved.kills),
+		}
+		if len(saved.auth) > 0 {
+			p.Auth = saved.auth
+		}
+		meta.Players = append(meta.Players, p)
+	}
+
+	return meta
+}
+
+// Enables or disables recording of the next games.
+func (s *Server) SetRecordDemos(enabled bool) {
+	if s.RecordDemos == enabled {
+		return
+	}
+	s.RecordDemos = enabled
+	if enabled {
+		s.Clients.Broadcast(nmc.ServerMessage, "the next game will be recorded")
+	} else {
+		s.Clients.Broadcast(nmc.ServerMessage, "the next game will not be recorded")
+	}
+}
+
+// in private mode, only privileged clients may download demos
+func (s *Server) canAccessDemos(c *Client) bool {
+	return c.Role > role.None || s.MasterMode < mastermode.Private
+}
+
+// Sends the list of demos in memory (the answer to /listdemos).
+func (s *Server) ListDemos(c *Client) {
+	if !s.canAccessDemos(c) {
+		c.Send(nmc.ServerMessage, cubecode.Fail("you can't do that"))
+		return
+	}
+	p := []interface{}{len(s.Demos)}
+	for _, d := range s.Demos {
+		p = append(p, d.Info())
+	}
+	c.Send(nmc.SendDemoList, p...)
+}
+
+// Sends the n-th demo (1-based, 0 meaning the latest) over the file channel (the answer to /getdemo). The tag is
+// chosen by the client to match the response to its request.
+func (s *Server) SendDemo(c *Client, n, tag int32) {
+	if !s.canAccessDemos(c) {
+		c.Send(nmc.ServerMessage, cubecode.Fail("you can't do that"))
+		return
+	}
+	if n == 0 {
+		n = int32(len(s.Demos))
+	}
+	if n < 1 || int(n) > len(s.Demos) {
+		c.Send(nmc.ServerMessage, cubecode.Fail(fmt.Sprintf("no demo %d available", n)))
+		return
+	}
+	d := s.Demos[n-1]
+	p := packet.Encode(nmc.SendDemo, tag)
+	c.Peer.Send(2, append(p, d.Data...))
+}
+
+// Removes the n-th demo (1-based) from memory, or all demos if n is 0.
+func (s *Server) ClearDemos(c *Client, n int32) {
+	if c.Role < role.Admin {
+		c.Send(nmc.ServerMessage, cubecode.Fail("you can't do that"))
+		return
+	}
+	if n == 0 {
+		s.Demos = nil
+		s.Clients.Broadcast(nmc.ServerMessage, "cleared all demos")
+		return
+	}
+	if n < 1 || int(n) > len(s.Demos) {
+		c.Send(nmc.ServerMessage, cubecode.Fail(fmt.Sprintf("no demo %d available", n)))
+		return
+	}
+	s.Demos = append(s.Demos[:n-1], s.Demos[n:]...)
+	s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("cleared demo %d", n))
+}
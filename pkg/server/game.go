@@ -31,6 +31,28 @@ func (s *Server) StartMode(id gamemode.ID) game.Mode {
 		return game.NewInstaCTF(s, s.KeepTeams)
 	case gamemode.EfficCTF:
 		return game.NewEfficCTF(s, s.KeepTeams)
+	case gamemode.Protect:
+		return game.NewProtect(s, s.KeepTeams)
+	case gamemode.InstaProtect:
+		return game.NewInstaProtect(s, s.KeepTeams)
+	case gamemode.EfficProtect:
+		return game.NewEfficProtect(s, s.KeepTeams)
+	case gamemode.Hold:
+		return game.NewHold(s, s.KeepTeams)
+	case gamemode.InstaHold:
+		return game.NewInstaHold(s, s.KeepTeams)
+	case gamemode.EfficHold:
+		return game.NewEfficHold(s, s.KeepTeams)
+	case gamemode.Capture:
+		return game.NewCapture(s, s.KeepTeams)
+	case gamemode.RegenCapture:
+		return game.NewRegenCapture(s, s.KeepTeams)
+	case gamemode.Collect:
+		return game.NewCollect(s, s.KeepTeams)
+	case gamemode.InstaCollect:
+		return game.NewInstaCollect(s, s.KeepTeams)
+	case gamemode.EfficCollect:
+		return game.NewEfficCollect(s, s.KeepTeams)
 	default:
 		panic(fmt.Sprintf("unhandled gamemode ID %d", id))
 	}
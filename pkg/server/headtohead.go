@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+)
+
+// Returns the client's name without color codes, followed by its CN if another client uses the same name.
+func (s *Server) exportName(c *Client) string {
+	return cubecode.SanitizeString(s.Clients.UniqueName(c))
+}
+
+// names the player with the given CN, or just the CN if that player left
+func (s *Server) victimName(cn uint32) string {
+	c := s.Clients.GetClientByCN(cn)
+	if c == nil || c.Peer == nil {
+		return fmt.Sprintf("cn %d", cn)
+	}
+	return s.exportName(c)
+}
+
+// FragMatrix returns who fragged whom in the current game, with which weapon and how often, as fragger name → victim
+// name → weapon name → count. Names are followed by the CN when several players use the same name. Only players still
+// connected are included as fraggers.
+func (s *Server) FragMatrix() map[string]map[string]map[string]int {
+	matrix := map[string]map[string]map[string]int{}
+	s.Clients.ForEach(func(c *Client) {
+		if len(c.Kills) == 0 {
+			return
+		}
+		matrix[s.exportName(c)] = s.exportKills(c.Kills)
+	})
+	return matrix
+}
+
+// converts kills to victim name → weapon name → count
+func (s *Server) exportKills(kills game.Kills) map[string]map[string]int {
+	if len(kills) == 0 {
+		return nil
+	}
+	exported := map[string]map[string]int{}
+	for victim, byWeapon := range kills {
+		name := s.victimName(victim)
+		if exported[name] == nil {
+			exported[name] = map[string]int{}
+		}
+		for wpn, n := range byWeapon {
+			exported[name][wpn.String()] += n
+		}
+	}
+	return exported
+}
+
+// Writes the frag matrix of the game that just ended to the log.
+func (s *Server) logFragMatrix() {
+	matrix := s.FragMatrix()
+	if len(matrix) == 0 {
+		return
+	}
+	data, err := json.Marshal(matrix)
+	if err != nil {
+		log.Println("error encoding frag matrix:", err)
+		return
+	}
+	log.Printf("frag matrix of %s on %s: %s", s.GameMode.ID(), s.Map, data)
+}
+
+// Moves the frags of the player who had CN from to CN to, in all clients' and saved states' kills.
+func (s *Server) moveVictim(from, to uint32) {
+	s.Clients.ForEach(func(c *Client) { c.Kills.MoveVictim(from, to) })
+	for _, saved := range s.savedStates {
+		saved.kills.MoveVictim(from, to)
+	}
+}
+
+// Removes the frags of the player with the given CN from all clients' and saved states' kills.
+func (s *Server) forgetVictim(cn uint32) {
+	s.Clients.ForEach(func(c *Client) { delete(c.Kills, cn) })
+	for _, saved := range s.savedStates {
+		delete(saved.kills, cn)
+	}
+}
+
+// describes the frags of victim in kills, e.g. "5 (rifle 3, shotgun 2)"
+func describeKills(kills game.Kills, victim uint32) string {
+	total := kills.Of(victim)
+	if total == 0 {
+		return "0"
+	}
+
+	byWeapon := make([]string, 0, len(kills[victim]))
+	for wpn, n := range kills[victim] {
+		byWeapon = append(byWeapon, fmt.Sprintf("%s %d", wpn, n))
+	}
+	sort.Strings(byWeapon)
+	return fmt.Sprintf("%d (%s)", total, strings.Join(byWeapon, ", "))
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"math"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/geom"
+	"github.com/sauerbraten/waiter/pkg/protocol/weapon"
+)
+
+const (
+	// player hit box (see game.h)
+	playerRadius    = 4.1
+	playerEyeHeight = 14.0
+	playerAboveEye  = 1.0
+
+	// allows for rounding of positions and weapon offsets
+	hitTolerance = 4.0
+
+	// clients interpolate other players' positions, so what a shooter sees is a little older than its ping suggests
+	rewindSlack = 100 * time.Millisecond
+)
+
+// the speed a player could have moved at, given their last reported velocity
+func possibleSpeed(velocity *geom.Vector) float64 {
+	return math.Max(maxPlayerSpeed*playerSpeedTolerance, velocity.Magnitude())
+}
+
+// Reports wether a shot from 'from' could have been fired by the client, i.e. originates near its eyes.
+func (s *Server) plausibleShotOrigin(c *Client, from *geom.Vector) bool {
+	m, ok := c.Movements.Latest()
+	if !ok {
+		return true
+	}
+	eyes := m.Position.Add(geom.NewVector(0, 0, playerEyeHeight))
+	tolerance := playerRadius + hitTolerance + possibleSpeed(m.Velocity)*rewindSlack.Seconds()
+	return geom.Distance(eyes, from) <= tolerance
+}
+
+// Reports wether a shot from 'from' to 'to' could have hit the target where the shooter saw it, i.e. where the target
+// was one ping ago.
+func (s *Server) plausibleHit(shooter, target *Client, wpn weapon.Weapon, from, to *geom.Vector) bool {
+	seenAt := time.Now().Add(-time.Duration(shooter.Ping) * time.Millisecond)
+	m, ok := target.Movements.At(seenAt)
+	if !ok {
+		// nothing to check against
+		return true
+	}
+
+	uncertainty := m.Time.Sub(seenAt)
+	if uncertainty < 0 {
+		uncertainty = -uncertainty
+	}
+	uncertainty += rewindSlack
+
+	tolerance := playerRadius + hitTolerance + possibleSpeed(m.Velocity)*uncertainty.Seconds()
+	if wpn.Spread > 0 {
+		// rays are spread around the aimed at point
+		tolerance += geom.Distance(from, m.Position) * float64(wpn.Spread) / 1000
+	}
+
+	// the shot's end may have been cut short at the hit, so extend it a little
+	to = to.Add(to.Sub(from).Scale(tolerance))
+
+	feet := m.Position
+	head := feet.Add(geom.NewVector(0, 0, playerEyeHeight+playerAboveEye))
+
+	return geom.SegmentDistance(from, to, feet, head) <= tolerance
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/sauerbraten/jsonfile"
+
+	"github.com/sauerbraten/waiter/pkg/ogz"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+)
+
+// Known-good CRCs of map files, by map name.
+type MapCRCs map[string]uint32
+
+// LoadMapCRCs reads a JSON object mapping map names to CRCs from the file at path.
+func LoadMapCRCs(path string) (MapCRCs, error) {
+	var crcs MapCRCs
+	err := jsonfile.ParseFile(path, &crcs)
+	return crcs, err
+}
+
+// Returns the CRC clients must report for the map, taken from the map file loaded from the maps directory (m, may be
+// nil), or looked up in the configured list of known CRCs. 0 means the map can not be checked.
+func (s *Server) expectedMapCRC(mapname string, m *ogz.Map) uint32 {
+	if m != nil {
+		return m.CRC
+	}
+	return s.MapCRCs[mapname]
+}
+
+// Handles the CRC of a client's map file, sent after loading the map.
+func (s *Server) checkMapCRC(c *Client, mapname string, crc uint32) {
+	if mapname != s.Map || s.MapCRC == 0 {
+		return
+	}
+
+	c.MapCRC = crc
+	c.ModifiedMap = crc != s.MapCRC
+	if !c.ModifiedMap {
+		return
+	}
+
+	log.Printf("%s is using a modified map (CRC %d, expected %d)", c, crc, s.MapCRC)
+	s.Clients.Broadcast(nmc.ServerMessage, cubecode.Red(fmt.Sprintf("%s is using a modified map", s.Clients.UniqueName(c))))
+
+	if s.CompetitiveMode && c.State != playerstate.Spectator {
+		s.SetSpectator(c, true)
+		s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("%s was forced to spectate because of a modified map", s.Clients.UniqueName(c)))
+	}
+}
+
+// Lists the players whose maps differ from the server's version (the answer to /checkmaps).
+func (s *Server) CheckMaps(requester *Client) {
+	if s.MapCRC == 0 {
+		requester.Send(nmc.ServerMessage, cubecode.Fail(fmt.Sprintf("can't check maps: no CRC known for %s", s.Map)))
+		return
+	}
+
+	ok := true
+	s.Clients.ForEach(func(c *Client) {
+		switch {
+		case c.ModifiedMap:
+			requester.Send(nmc.ServerMessage, cubecode.Red(fmt.Sprintf("%s has a modified map", s.Clients.UniqueName(c))))
+		case c.MapCRC == 0 && c.State != playerstate.Spectator:
+			requester.Send(nmc.ServerMessage, cubecode.Orange(fmt.Sprintf("%s has not sent a map CRC", s.Clients.UniqueName(c))))
+		default:
+			return
+		}
+		ok = false
+	})
+	if ok {
+		requester.Send(nmc.ServerMessage, cubecode.Green("all players have the correct map"))
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/role"
+)
+
+const (
+	// a player's maximum running speed in cube units per second (see physics.cpp)
+	maxPlayerSpeed = 100.0
+
+	// allows for strafe jumping, slopes and network jitter
+	playerSpeedTolerance = 1.5
+
+	// movement is checked over spans of this duration, so single late or bunched up updates don't matter
+	movementCheckSpan = 1 * time.Second
+
+	// updates are only checked once they are this old: jump pad and teleport messages are sent on another channel and
+	// can arrive after the position update that already shows the player at the destination
+	movementCheckDelay = 500 * time.Millisecond
+
+	// after jump pads, teleports and hit pushes, movement is not checked for this long
+	pushedGracePeriod = 3 * time.Second
+)
+
+// Checks the client's last position update for impossible displacement, like caused by speed or teleport hacks.
+func (s *Server) checkMovement(c *Client) {
+	from, to, ok := c.Movements.Span(movementCheckDelay, movementCheckSpan)
+	if !ok || to.Time.Sub(c.LastPushed) < movementCheckSpan+pushedGracePeriod {
+		return
+	}
+
+	distance, elapsed := game.HorizontalDistance(from, to), to.Time.Sub(from.Time)
+	if distance <= maxPlayerSpeed*playerSpeedTolerance*elapsed.Seconds() {
+		return
+	}
+
+	// only report again after a full check span of new updates
+	c.Movements.Clear()
+	c.SuspiciousMovements++
+
+	msg := fmt.Sprintf("suspicious movement by %s: %.0f units in %s", s.Clients.UniqueName(c), distance, elapsed.Round(time.Millisecond))
+	log.Println(msg)
+	s.Clients.ForEach(func(admin *Client) {
+		if admin.Role >= role.Admin {
+			admin.Send(nmc.ServerMessage, cubecode.Orange(msg))
+		}
+	})
+
+	if s.SuspiciousMovementLimit > 0 && c.SuspiciousMovements >= s.SuspiciousMovementLimit {
+		c.SuspiciousMovements = 0
+		s.SetSpectator(c, true)
+		s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("%s was forced to spectate because of suspicious movement", s.Clients.UniqueName(c)))
+	}
+}
@@ -44,6 +44,23 @@ func isValidMessage(c *Client, networkMessageCode nmc.ID) bool {
 	return true
 }
 
+// checks if a message is handled while the server plays back a demo.
+func isPlaybackMessage(networkMessageCode nmc.ID) bool {
+	switch networkMessageCode {
+	case nmc.Ping,
+		nmc.TryJoin,
+		nmc.AuthTry,
+		nmc.AuthAnswer,
+		nmc.ClientPing,
+		nmc.ChatMessage,
+		nmc.PauseGame,
+		nmc.ServerCommand:
+		return true
+	default:
+		return false
+	}
+}
+
 // parses a packet and decides what to do based on the network message code at the front of the packet
 func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet) {
 	// this implementation does not support channel 2 (for coop edit purposes) yet.
@@ -56,6 +73,11 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 	}
 
 	for len(p) > 0 {
+		if client.Peer == nil {
+			// client was disconnected while handling the previous message (e.g. kicked for a violation)
+			return
+		}
+
 		_nmc, ok := p.GetInt()
 		if !ok {
 			log.Println("could not read network message code (packet too short):", p)
@@ -69,6 +91,11 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 			return
 		}
 
+		if s.Playback != nil && !isPlaybackMessage(packetType) {
+			// clients only watch during playback, so anything else is ignored
+			return
+		}
+
 		switch packetType {
 
 		// channel 0 traffic
@@ -78,7 +105,10 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 			if client.State == playerstate.Alive {
 				q := p
 				client.Positions.Publish(packet.Encode(nmc.Position, q))
-				client.Position = parsePosition(&p)
+				if m, ok := parsePosition(&p); ok {
+					client.Move(m)
+					s.checkMovement(client)
+				}
 			}
 			return
 
@@ -94,6 +124,7 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 				return
 			}
 			if client.State == playerstate.Alive {
+				client.LastPushed = time.Now()
 				s.relay.FlushPositionAndSend(client.CN, packet.Encode(nmc.JumpPad, cn, jumppad))
 			}
 
@@ -119,6 +150,7 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 				return
 			}
 			if client.State == playerstate.Alive {
+				client.LastPushed = time.Now()
 				s.relay.FlushPositionAndSend(client.CN, packet.Encode(nmc.Teleport, cn, teleport, teledest))
 			}
 
@@ -307,26 +339,13 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 					client.Send(nmc.ServerMessage, cubecode.Fail("you can't do that"))
 					return
 				}
-			}
-			if (spectator.State == playerstate.Spectator) == (toggle != 0) {
-				// nothing to do
-				return
-			}
-			if toggle != 0 {
-				if client.State == playerstate.Alive {
-					s.GameMode.HandleFrag(&spectator.Player, &spectator.Player)
-				}
-				s.GameMode.Leave(&spectator.Player)
-				s.Clock.Leave(&spectator.Player)
-				spectator.State = playerstate.Spectator
-			} else {
-				spectator.State = playerstate.Dead
-				if teamedMode, ok := s.GameMode.(game.TeamMode); ok {
-					teamedMode.Join(&spectator.Player)
+				// in competitive mode, players with modified maps have to be unspecced by a master
+				if toggle == 0 && client.ModifiedMap && s.CompetitiveMode {
+					client.Send(nmc.ServerMessage, cubecode.Fail("you can't play with a modified map"))
+					return
 				}
-				// todo: checkmap
 			}
-			s.Clients.Broadcast(nmc.Spectator, spectator.CN, toggle)
+			s.SetSpectator(spectator, toggle != 0)
 
 		case nmc.VoteMap:
 			mapname, ok := p.GetString()
@@ -382,7 +401,9 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 				return
 			}
 			client.Ping = ping
-			client.Packets.Publish(nmc.ClientPing, client.Ping)
+			if s.Playback == nil {
+				client.Packets.Publish(nmc.ClientPing, client.Ping)
+			}
 
 		case nmc.ChatMessage:
 			// client sending chat message → broadcast to other clients
@@ -393,6 +414,9 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 			}
 			if strings.HasPrefix(msg, "#") {
 				s.Commands.Handle(client, msg[1:])
+			} else if s.Playback != nil {
+				// relaying the message would attribute it to the recorded player with the same CN
+				s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("%s: %s", s.Clients.UniqueName(client), cubecode.White(msg)))
 			} else {
 				client.Packets.Publish(nmc.ChatMessage, msg)
 			}
@@ -436,7 +460,15 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 				return
 			}
 
+			if s.AutoBalance && s.wouldUnbalance(client, teamName) {
+				client.Send(nmc.ServerMessage, cubecode.Fail("you can't switch teams: teams would be unbalanced"))
+				return
+			}
+
 			teamMode.ChangeTeam(&client.Player, teamName, false)
+			client.TeamLocked = false
+			client.PendingTeam = ""
+			s.checkTeamBalance()
 
 		case nmc.SetTeam:
 			_victim, ok := p.GetInt()
@@ -462,15 +494,69 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 			}
 
 			teamMode.ChangeTeam(&victim.Player, teamName, true)
+			victim.TeamLocked = victim.Team.Name == teamName
+			victim.PendingTeam = ""
+			s.checkTeamBalance()
 
 		case nmc.MapCRC:
 			// client sends crc hash of his map file
-			// TODO
-			//clientMapName := p.GetString()
-			//clientMapCRC := p.GetInt32()
-			p.GetString()
-			p.GetInt()
-			log.Println("todo: MAPCRC")
+			mapname, ok := p.GetString()
+			if !ok {
+				log.Println("could not read map name from map CRC packet:", p)
+				return
+			}
+			crc, ok := p.GetInt()
+			if !ok {
+				log.Println("could not read CRC from map CRC packet:", p)
+				return
+			}
+			s.checkMapCRC(client, mapname, uint32(crc))
+
+		case nmc.CheckMaps:
+			s.CheckMaps(client)
+
+		case nmc.ListDemos:
+			s.ListDemos(client)
+
+		case nmc.GetDemo:
+			n, ok := p.GetInt()
+			if !ok {
+				log.Println("could not read demo number from getdemo packet:", p)
+				return
+			}
+			tag, ok := p.GetInt()
+			if !ok {
+				log.Println("could not read tag from getdemo packet:", p)
+				return
+			}
+			s.SendDemo(client, n, tag)
+
+		case nmc.ClearDemos:
+			n, ok := p.GetInt()
+			if !ok {
+				log.Println("could not read demo number from cleardemos packet:", p)
+				return
+			}
+			s.ClearDemos(client, n)
+
+		case nmc.RecordDemo:
+			val, ok := p.GetInt()
+			if !ok {
+				log.Println("could not read value from recorddemo packet:", p)
+				return
+			}
+			if client.Role < role.Master {
+				client.Send(nmc.ServerMessage, cubecode.Fail("you can't do that"))
+				return
+			}
+			s.SetRecordDemos(val != 0)
+
+		case nmc.StopDemo:
+			if client.Role < role.Admin {
+				client.Send(nmc.ServerMessage, cubecode.Fail("you can't do that"))
+				return
+			}
+			s.stopDemoRecording()
 
 		case nmc.TrySpawn:
 			if !client.Joined || client.State != playerstate.Dead || !client.LastSpawnAttempt.IsZero() || !s.GameMode.CanSpawn(&client.Player) {
@@ -502,12 +588,15 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 			requested := weapon.ID(_requested)
 			selected, ok := client.SelectWeapon(requested)
 			if !ok {
+				if client.State == playerstate.Alive {
+					s.Violation(client, fmt.Sprintf("selected weapon %d without ammo for it", requested))
+				}
 				break
 			}
 			client.Packets.Publish(nmc.ChangeWeapon, selected.ID)
 
 		case nmc.Shoot:
-			wpn, id, from, to, hits, ok := parseShoot(client, &p)
+			wpn, id, from, to, hits, ok := parseShoot(&p)
 			if !ok {
 				return
 			}
@@ -521,7 +610,7 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 			s.HandleExplode(client, millis, wpn, id, hits)
 
 		case nmc.Suicide:
-			s.GameMode.HandleFrag(&client.Player, &client.Player)
+			s.handleFrag(client, client)
 
 		case nmc.Sound:
 			sound, ok := p.GetInt()
@@ -537,7 +626,8 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 				log.Println("could not read pause toggle from pause packet:", p)
 				return
 			}
-			if s.MasterMode < mastermode.Locked {
+			// like the pause command, pausing demo playback is open to everyone
+			if s.MasterMode < mastermode.Locked && s.Playback == nil {
 				if client.Role == role.None {
 					return
 				}
@@ -571,15 +661,24 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, p protocol.Packet
 	return
 }
 
-func parsePosition(p *protocol.Packet) (pos *geom.Vector) {
-	// parse position out of packet
+func parsePosition(p *protocol.Packet) (m game.Movement, success bool) {
 	_, ok := p.GetUint() // we don't support bots so we know it's from the client themselves
 	if !ok {
 		log.Println("could not read CN from position packet (packet too short):", p)
 		return
 	}
-	p.GetByte() // state, not used
-	flags, ok := p.GetByte()
+	// 3 bits physics state, 1 bit life sequence, 2 bits move, 2 bits strafe
+	state, ok := p.GetByte()
+	if !ok {
+		log.Println("could not read physics state from position packet (packet too short):", p)
+		return
+	}
+	// 3 bits position, 1 bit velocity, 3 bits falling, 1 bit material, 1 bit crouching
+	flags, ok := p.GetUint()
+	if !ok {
+		log.Println("could not read flags from position packet (packet too short):", p)
+		return
+	}
 
 	xyz := [3]float64{}
 	for i := range xyz {
@@ -608,13 +707,114 @@ func parsePosition(p *protocol.Packet) (pos *geom.Vector) {
 		xyz[i] = float64(c)
 	}
 
-	// rest of packet is not needed yet
+	// reads two bytes containing yaw and pitch
+	readDirection := func(what string) (yaw, pitch float64, ok bool) {
+		d1, ok := p.GetByte()
+		if !ok {
+			log.Printf("could not read first byte of %s direction from position packet (packet too short): %v", what, p)
+			return
+		}
+		d2, ok := p.GetByte()
+		if !ok {
+			log.Printf("could not read second byte of %s direction from position packet (packet too short): %v", what, p)
+			return
+		}
+		dir := int(d1) | int(d2)<<8
+		return float64(dir % 360), float64(clamp(dir/360, 0, 180) - 90), true
+	}
+
+	// reads one or two bytes of magnitude
+	readMagnitude := func(what string, long bool) (float64, bool) {
+		m1, ok := p.GetByte()
+		if !ok {
+			log.Printf("could not read %s magnitude from position packet (packet too short): %v", what, p)
+			return 0, false
+		}
+		mag := int(m1)
+		if long {
+			m2, ok := p.GetByte()
+			if !ok {
+				log.Printf("could not read second byte of %s magnitude from position packet (packet too short): %v", what, p)
+				return 0, false
+			}
+			mag |= int(m2) << 8
+		}
+		return float64(mag), true
+	}
 
-	pos = geom.NewVector(xyz[0], xyz[1], xyz[2]).Mul(1 / geom.DMF)
-	return
+	yaw, pitch, ok := readDirection("view")
+	if !ok {
+		return
+	}
+	_roll, ok := p.GetByte()
+	if !ok {
+		log.Println("could not read roll from position packet (packet too short):", p)
+		return
+	}
+	roll := float64(clamp(int(_roll), 0, 180) - 90)
+
+	velocityMagnitude, ok := readMagnitude("velocity", flags&(1<<3) != 0)
+	if !ok {
+		return
+	}
+	velocityYaw, velocityPitch, ok := readDirection("velocity")
+	if !ok {
+		return
+	}
+	velocity := geom.VectorFromYawPitch(velocityYaw, velocityPitch).Mul(velocityMagnitude)
+
+	falling := geom.NewVector(0, 0, 0)
+	if flags&(1<<4) != 0 {
+		fallingMagnitude, ok := readMagnitude("falling", flags&(1<<5) != 0)
+		if !ok {
+			return
+		}
+		falling = geom.NewVector(0, 0, -1)
+		if flags&(1<<6) != 0 {
+			fallingYaw, fallingPitch, ok := readDirection("falling")
+			if !ok {
+				return
+			}
+			falling = geom.VectorFromYawPitch(fallingYaw, fallingPitch)
+		}
+		falling = falling.Mul(fallingMagnitude)
+	}
+
+	// move and strafe are encoded as 0, 1 or 2 (= -1)
+	direction := func(bits byte) int32 {
+		if bits&2 != 0 {
+			return -1
+		}
+		return int32(bits & 1)
+	}
+
+	return game.Movement{
+		Time:       time.Now(),
+		Position:   geom.NewVector(xyz[0], xyz[1], xyz[2]).Mul(1 / geom.DMF),
+		Yaw:        yaw,
+		Pitch:      pitch,
+		Roll:       roll,
+		Velocity:   velocity,
+		Falling:    falling,
+		Physics:    game.PhysicsState(state & 7),
+		Move:       direction((state >> 4) & 3),
+		Strafe:     direction((state >> 6) & 3),
+		Crouching:  flags&(1<<8) != 0,
+		InGameClip: flags&(1<<7) != 0,
+	}, true
 }
 
-func parseShoot(client *Client, p *protocol.Packet) (wpn weapon.Weapon, id int32, from, to *geom.Vector, hits []hit, success bool) {
+func clamp(i, min, max int) int {
+	if i < min {
+		return min
+	}
+	if i > max {
+		return max
+	}
+	return i
+}
+
+func parseShoot(p *protocol.Packet) (wpn weapon.Weapon, id int32, from, to *geom.Vector, hits []hit, success bool) {
 	id, ok := p.GetInt()
 	if !ok {
 		log.Println("could not read shot ID from shoot packet:", p)
@@ -626,9 +826,6 @@ func parseShoot(client *Client, p *protocol.Packet) (wpn weapon.Weapon, id int32
 		return
 	}
 	wpn = weapon.ByID(weapon.ID(weaponID))
-	if time.Now().Before(client.GunReloadEnd) || client.Ammo[wpn.ID] <= 0 {
-		return
-	}
 	from, ok = parseVector(p)
 	if !ok {
 		log.Println("could not read shot origin vector ('from') from shoot packet:", p)
@@ -666,7 +863,7 @@ func parseExplode(client *Client, p *protocol.Packet) (millis int32, wpn weapon.
 		return
 	}
 	wpn = weapon.ByID(weapon.ID(weaponID))
-	_, ok = p.GetInt() // TODO: use projectile ID to link to shot
+	id, ok = p.GetInt()
 	if !ok {
 		log.Println("could not read projectile ID from explode packet:", p)
 		return
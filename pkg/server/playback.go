@@ -0,0 +1,243 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/demo"
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+)
+
+// how often recorded packets due for sending are sent to clients
+const playbackTickInterval = 10 * time.Millisecond
+
+// Playback replays a recorded game to all connected clients, who watch it as spectators. It replaces the game clock
+// while the server is in playback mode, so pausing the game or setting the time left pauses or seeks the playback.
+type Playback struct {
+	s       *Server
+	packets []demo.Packet
+	next    int // index of the next packet to send
+
+	offset  time.Duration // position in the recording when playback was last (re)started
+	resumed time.Time     // when playback was last (re)started
+	paused  bool          // paused by a player
+	idle    bool          // waiting for clients to connect
+}
+
+var _ game.Clock = &Playback{}
+
+// StartPlayback puts the server into playback mode, replaying the demo file at path instead of hosting games. The
+// server's map and mode are set to the recorded ones. Playback starts when the first client connects.
+func (s *Server) StartPlayback(path string) error {
+	packets, err := demo.Load(path)
+	if err != nil {
+		return err
+	}
+	if len(packets) == 0 {
+		return errors.New("demo contains no packets")
+	}
+
+	// recorded demos start with a welcome packet describing the game
+	p := protocol.Packet(packets[0].Data)
+	typ, _ := p.GetInt()
+	change, _ := p.GetInt()
+	mapname, _ := p.GetString()
+	mode, ok := p.GetInt()
+	if !ok || nmc.ID(typ) != nmc.Welcome || nmc.ID(change) != nmc.MapChange || !gamemode.Valid(gamemode.ID(mode)) {
+		return errors.New("demo does not start with a welcome packet")
+	}
+
+	s.Playback = &Playback{
+		s:       s,
+		packets: packets,
+		idle:    true,
+	}
+	s.Map = mapname
+	s.GameMode = s.StartMode(gamemode.ID(mode))
+	s.Clock = s.Playback
+
+	go func() {
+		for range time.Tick(playbackTickInterval) {
+			s.callbacks <- s.Playback.tick
+		}
+	}()
+
+	log.Printf("playing back %s (%s on %s, %s)", path, s.GameMode.ID(), s.Map, s.Playback.duration().Round(time.Second))
+
+	return nil
+}
+
+func (pb *Playback) duration() time.Duration {
+	return time.Duration(pb.packets[len(pb.packets)-1].Millis) * time.Millisecond
+}
+
+func (pb *Playback) running() bool {
+	return !pb.paused && !pb.idle && !pb.Ended()
+}
+
+// current position in the recording
+func (pb *Playback) position() time.Duration {
+	if !pb.running() {
+		return pb.offset
+	}
+	return pb.offset + time.Since(pb.resumed)
+}
+
+// changes the playback state, keeping track of the position
+func (pb *Playback) setState(update func()) {
+	pb.offset = pb.position()
+	update()
+	pb.resumed = time.Now()
+}
+
+// sends all packets that are due
+func (pb *Playback) tick() {
+	if !pb.running() {
+		return
+	}
+
+	pos := pb.position()
+	for pb.next < len(pb.packets) && time.Duration(pb.packets[pb.next].Millis)*time.Millisecond <= pos {
+		pkt := pb.packets[pb.next]
+		pb.s.Clients.ForEach(func(c *Client) {
+			if c.Joined {
+				c.Peer.Send(pkt.Channel, pkt.Data)
+			}
+		})
+		pb.next++
+	}
+
+	if pb.Ended() {
+		pb.offset = pb.duration()
+		pb.s.Clients.Broadcast(nmc.ServerMessage, "demo playback finished")
+	}
+}
+
+// concatenates the reliable packets (i.e. game events, not positions) up to the next packet to send
+func (pb *Playback) events() []byte {
+	var events []byte
+	for _, pkt := range pb.packets[:pb.next] {
+		if pkt.Channel == 1 {
+			events = append(events, pkt.Data...)
+		}
+	}
+	return events
+}
+
+// Sends the game state at the current position of the playback to c.
+func (pb *Playback) welcome(c *Client) {
+	// puts the client into spectator mode with CN -1, so it doesn't interfere with recorded players
+	c.Send(nmc.DemoPlayback, 1, -1)
+
+	// the recorded welcome packet and all game events so far
+	if pb.next == 0 {
+		pb.next = 1
+	}
+	c.Peer.Send(1, pb.events())
+
+	if pb.paused {
+		c.Send(nmc.PauseGame, 1, -1)
+	}
+}
+
+// Puts a client into playback mode.
+func (pb *Playback) join(c *Client) {
+	c.Joined = true
+	c.State = playerstate.Spectator
+	pb.s.SendWelcome(c)
+
+	if pb.idle {
+		pb.setState(func() { pb.idle = false })
+	}
+
+	c.Send(nmc.ServerMessage, fmt.Sprintf("this server is playing back a demo of %s on %s, use %s to seek",
+		pb.s.GameMode.ID(), pb.s.Map, cubecode.Green("#seek")))
+}
+
+// Seek jumps to the given position in the recording. Clients receive all game events up to the new position.
+func (pb *Playback) Seek(pos time.Duration) {
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > pb.duration() {
+		pos = pb.duration()
+	}
+
+	var events []byte
+	if pos < pb.position() {
+		// replay from the start, after removing the recorded players
+		pb.next = 1
+		pb.s.Clients.ForEach(func(c *Client) {
+			if c.Joined {
+				c.Send(nmc.DemoPlayback, 0, -1)
+				c.Send(nmc.DemoPlayback, 1, -1)
+			}
+		})
+		events = pb.events()
+	}
+
+	for pb.next < len(pb.packets) && time.Duration(pb.packets[pb.next].Millis)*time.Millisecond <= pos {
+		if pkt := pb.packets[pb.next]; pkt.Channel == 1 {
+			events = append(events, pkt.Data...)
+		}
+		pb.next++
+	}
+
+	pb.s.Clients.ForEach(func(c *Client) {
+		if c.Joined {
+			c.Peer.Send(1, events)
+		}
+	})
+
+	pb.offset = pos
+	pb.resumed = time.Now()
+}
+
+// Restarts the playback from the beginning once the next client connects.
+func (pb *Playback) reset() {
+	pb.setState(func() { pb.idle = true })
+	pb.next = 0
+	pb.offset = 0
+	pb.paused = false
+}
+
+func (pb *Playback) Start() {}
+
+func (pb *Playback) Pause(*game.Player) {
+	if pb.paused {
+		return
+	}
+	pb.setState(func() { pb.paused = true })
+	pb.s.Broadcast(nmc.PauseGame, 1, -1)
+}
+
+func (pb *Playback) Paused() bool { return pb.paused }
+
+func (pb *Playback) Resume(*game.Player) {
+	if !pb.paused {
+		return
+	}
+	pb.setState(func() { pb.paused = false })
+	pb.s.Broadcast(nmc.PauseGame, 0, -1)
+}
+
+func (pb *Playback) Stop() { pb.Pause(nil) }
+
+func (pb *Playback) Ended() bool { return pb.next >= len(pb.packets) }
+
+func (pb *Playback) TimeLeft() time.Duration { return pb.duration() - pb.position() }
+
+func (pb *Playback) SetTimeLeft(timeLeft time.Duration) { pb.Seek(pb.duration() - timeLeft) }
+
+func (pb *Playback) Leave(*game.Player) {}
+
+func (pb *Playback) ScoreChanged() {}
+
+func (pb *Playback) CleanUp() {}
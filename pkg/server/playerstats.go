@@ -0,0 +1,184 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+	"github.com/sauerbraten/waiter/pkg/stats"
+)
+
+// Returns the players who won the current game: the members of the best team in team modes, the players with the most
+// frags otherwise. Tied games have no winners.
+func (s *Server) winners(players []*Client) map[*Client]bool {
+	winners := map[*Client]bool{}
+
+	if teams, scoring := s.rankedTeams(); teams != nil {
+		if len(teams) == 0 {
+			return winners
+		}
+		if len(teams) > 1 {
+			best, second := teams[0], teams[1]
+			if (!scoring || best.Score == second.Score) && best.Frags == second.Frags {
+				return winners
+			}
+		}
+		for _, c := range players {
+			if c.Team.Name == teams[0].Name {
+				winners[c] = true
+			}
+		}
+		return winners
+	}
+
+	var best []*Client
+	for _, c := range players {
+		if len(best) == 0 || c.Frags > best[0].Frags {
+			best = []*Client{c}
+		} else if c.Frags == best[0].Frags {
+			best = append(best, c)
+		}
+	}
+	if len(best) == 1 {
+		winners[best[0]] = true
+	}
+	return winners
+}
+
+// Adds the results of the game that just ended to the lifetime statistics of all authenticated players.
+func (s *Server) recordPlayerStats() {
+	if s.PlayerStats == nil || s.Playback != nil {
+		return
+	}
+
+	var players []*Client
+	s.Clients.ForEach(func(c *Client) {
+		if c.Joined && c.State != playerstate.Spectator {
+			players = append(players, c)
+		}
+	})
+	if len(players) == 0 {
+		return
+	}
+
+	winners := s.winners(players)
+	mode := s.GameMode.ID().String()
+	_, flagMode := s.GameMode.(game.FlagMode)
+
+	for _, c := range players {
+		g := stats.Game{
+			Games:           1,
+			Frags:           c.Frags,
+			Deaths:          c.Deaths,
+			Damage:          int64(c.Damage),
+			DamagePotential: int64(c.DamagePotential),
+		}
+		if winners[c] {
+			g.Wins = 1
+		}
+		if flagMode {
+			g.Flags = c.Flags
+		}
+		for domain, a := range c.Authentications {
+			if a.name != "" {
+				s.PlayerStats.Add(domain, a.name, mode, g)
+			}
+		}
+	}
+
+	s.updateRatings(players)
+
+	go func() {
+		err := s.PlayerStats.Save()
+		if err != nil {
+			log.Println("error saving player statistics:", err)
+		}
+	}()
+}
+
+// number of players listed by #top
+const leaderboardSize = 5
+
+// A statistic players can be ranked by.
+type leaderboardCategory struct {
+	name    string
+	aliases []string
+	title   string
+	format  string
+	value   func(*stats.Game) float64
+}
+
+var leaderboardCategories = []*leaderboardCategory{
+	{"frags", nil, "frags", "%.0f", func(g *stats.Game) float64 { return float64(g.Frags) }},
+	{"kpd", nil, "KPD", "%.2f", (*stats.Game).KPD},
+	{"acc", []string{"accuracy"}, "accuracy", "%.0f%%", (*stats.Game).Accuracy},
+	{"flags", nil, "flags", "%.0f", func(g *stats.Game) float64 { return float64(g.Flags) }},
+}
+
+func findLeaderboardCategory(name string) *leaderboardCategory {
+	name = strings.ToLower(name)
+	for _, cat := range leaderboardCategories {
+		if cat.name == name {
+			return cat
+		}
+		for _, alias := range cat.aliases {
+			if alias == name {
+				return cat
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the lines listing the best players of the mode in the category.
+func (s *Server) leaderboard(mode gamemode.ID, cat *leaderboardCategory) []string {
+	entries := s.PlayerStats.Leaderboard(s.StatsServerAuthDomain, mode.String(), s.StatsMinGames, cat.value)
+	if len(entries) == 0 {
+		return []string{fmt.Sprintf("no %s player has played %d games yet", mode, s.StatsMinGames)}
+	}
+	if len(entries) > leaderboardSize {
+		entries = entries[:leaderboardSize]
+	}
+
+	lines := []string{fmt.Sprintf("%s: best %s players by %s (min. %d games)", cubecode.Yellow("top"), mode, cat.title, s.StatsMinGames)}
+	for i, e := range entries {
+		lines = append(lines, fmt.Sprintf("%d. %s %s (%d games)", i+1, cubecode.Green(e.Name), fmt.Sprintf(cat.format, e.Value), e.Stats.Games))
+	}
+	return lines
+}
+
+// Returns a line describing the position of the player with the given auth name in each category of the current mode.
+func (s *Server) rank(name string) string {
+	mode := s.GameMode.ID()
+	p, ok := s.PlayerStats.Get(s.StatsServerAuthDomain, name)
+	if !ok {
+		return fmt.Sprintf("%s has no recorded games", cubecode.Green(name))
+	}
+	games := 0
+	if g, ok := p.Modes[mode.String()]; ok {
+		games = g.Games
+	}
+	if games < s.StatsMinGames {
+		return fmt.Sprintf("%s has played %d %s games, %d are needed to be ranked", cubecode.Green(name), games, mode, s.StatsMinGames)
+	}
+
+	_, flagMode := s.GameMode.(game.FlagMode)
+	var positions []string
+	for _, cat := range leaderboardCategories {
+		if cat.name == "flags" && !flagMode {
+			continue
+		}
+		entries := s.PlayerStats.Leaderboard(s.StatsServerAuthDomain, mode.String(), s.StatsMinGames, cat.value)
+		for i, e := range entries {
+			if e.Name == name {
+				positions = append(positions, fmt.Sprintf("#%d of %d by %s (%s)", i+1, len(entries), cat.title, fmt.Sprintf(cat.format, e.Value)))
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("%s in %s: %s", cubecode.Green(name), mode, strings.Join(positions, ", "))
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/stats"
+)
+
+// returns the name the client is authenticated as with the stats server's domain
+func (s *Server) statsName(c *Client) (string, bool) {
+	a, ok := c.Authentications[s.StatsServerAuthDomain]
+	if !ok || a.name == "" {
+		return "", false
+	}
+	return a.name, true
+}
+
+// Rating returns the skill rating of the client's stats server auth name. Unauthenticated clients, and all clients
+// when player statistics are disabled, have the default rating.
+func (s *Server) Rating(c *Client) float64 {
+	name, ok := s.statsName(c)
+	if !ok || s.PlayerStats == nil {
+		return stats.DefaultRating
+	}
+	rating, _ := s.PlayerStats.Rating(s.StatsServerAuthDomain, name)
+	return rating
+}
+
+// TeamRating returns the average rating of the given clients, or the default rating if there are none.
+func (s *Server) TeamRating(clients []*Client) float64 {
+	if len(clients) == 0 {
+		return stats.DefaultRating
+	}
+	sum := 0.0
+	for _, c := range clients {
+		sum += s.Rating(c)
+	}
+	return sum / float64(len(clients))
+}
+
+// the result of a game for team a against team b: 1 for a win, 0.5 for a draw, 0 for a loss
+func teamResult(a, b *game.Team, scoring bool) float64 {
+	switch {
+	case scoring && a.Score != b.Score:
+		return score(a.Score > b.Score)
+	case a.Frags != b.Frags:
+		return score(a.Frags > b.Frags)
+	default:
+		return 0.5
+	}
+}
+
+func score(won bool) float64 {
+	if won {
+		return 1
+	}
+	return 0
+}
+
+// Computes the rating changes of the game that just ended: in team modes, every team plays against every other team,
+// rated as the average of its players; otherwise, every player plays against every other player and wins against
+// those with less frags.
+func (s *Server) ratingChanges(players []*Client) map[*Client]float64 {
+	changes := map[*Client]float64{}
+
+	if teams, scoring := s.rankedTeams(); teams != nil {
+		members := map[*game.Team][]*Client{}
+		for _, t := range teams {
+			for _, c := range players {
+				if c.Team.Name == t.Name {
+					members[t] = append(members[t], c)
+				}
+			}
+		}
+		playing := make([]*game.Team, 0, len(teams))
+		for _, t := range teams {
+			if len(members[t]) > 0 {
+				playing = append(playing, t)
+			}
+		}
+		if len(playing) < 2 {
+			return changes
+		}
+
+		for _, t := range playing {
+			change := 0.0
+			for _, other := range playing {
+				if other != t {
+					expected := stats.Expected(s.TeamRating(members[t]), s.TeamRating(members[other]))
+					change += stats.RatingChange(teamResult(t, other, scoring), expected)
+				}
+			}
+			for _, c := range members[t] {
+				changes[c] = change / float64(len(playing)-1)
+			}
+		}
+		return changes
+	}
+
+	if len(players) < 2 {
+		return changes
+	}
+	for _, c := range players {
+		change := 0.0
+		for _, other := range players {
+			if other == c {
+				continue
+			}
+			result := 0.5
+			if c.Frags != other.Frags {
+				result = score(c.Frags > other.Frags)
+			}
+			change += stats.RatingChange(result, stats.Expected(s.Rating(c), s.Rating(other)))
+		}
+		changes[c] = change / float64(len(players)-1)
+	}
+	return changes
+}
+
+// Updates the ratings of the authenticated players of the game that just ended and tells them about it.
+func (s *Server) updateRatings(players []*Client) {
+	for c, change := range s.ratingChanges(players) {
+		name, ok := s.statsName(c)
+		if !ok {
+			continue
+		}
+		s.PlayerStats.AddRating(s.StatsServerAuthDomain, name, change)
+		c.Send(nmc.ServerMessage, fmt.Sprintf("your rating is now %.0f (%+.0f)", s.Rating(c), change))
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+)
+
+// The scores of a player who left the current game, kept in case they reconnect.
+type savedState struct {
+	keys            []string
+	cn              uint32
+	name            string
+	auth            map[string]string // auth name by domain
+	team            string
+	frags           int
+	deaths          int
+	teamkills       int
+	flags           int
+	flagReturns     int
+	damage          int32
+	damagePotential int32
+	damageReceived  int32
+	kills           game.Kills
+}
+
+// identifies a client by IP and name
+func addressKey(c *Client) string {
+	return fmt.Sprintf("%s|%s", c.Peer.Address.IP, c.Name)
+}
+
+// identifies a client by auth name
+func authKey(domain, name string) string {
+	return fmt.Sprintf("auth|%s|%s", domain, name)
+}
+
+// Keeps the scores and team of a client leaving the game until the game ends.
+func (s *Server) saveState(c *Client) {
+	if !c.Joined || s.Playback != nil {
+		return
+	}
+
+	saved := &savedState{
+		keys:            []string{addressKey(c)},
+		cn:              c.CN,
+		name:            c.Name,
+		auth:            map[string]string{},
+		team:            c.Team.Name,
+		frags:           c.Frags,
+		deaths:          c.Deaths,
+		teamkills:       c.Teamkills,
+		flags:           c.Flags,
+		flagReturns:     c.FlagReturns,
+		damage:          c.Damage,
+		damagePotential: c.DamagePotential,
+		damageReceived:  c.DamageReceived,
+		kills:           c.Kills,
+	}
+	for domain, a := range c.Authentications {
+		if a.name != "" {
+			saved.keys = append(saved.keys, authKey(domain, a.name))
+			saved.auth[domain] = a.name
+		}
+	}
+
+	for _, key := range saved.keys {
+		s.savedStates[key] = saved
+	}
+}
+
+// removes and returns the state saved under key
+func (s *Server) takeSavedState(key string) *savedState {
+	saved, ok := s.savedStates[key]
+	if !ok {
+		return nil
+	}
+	for _, key := range saved.keys {
+		delete(s.savedStates, key)
+	}
+	return saved
+}
+
+// Forgets all saved states, e.g. when a new game starts.
+func (s *Server) clearSavedStates() {
+	s.savedStates = map[string]*savedState{}
+	s.Clients.ForEach(func(c *Client) { c.PendingTeam = "" })
+}
+
+// adds the saved scores to the client's
+func (s *Server) restoreState(c *Client, saved *savedState) {
+	c.Frags += saved.frags
+	c.Deaths += saved.deaths
+	c.Teamkills += saved.teamkills
+	c.Flags += saved.flags
+	c.FlagReturns += saved.flagReturns
+	c.Damage += saved.damage
+	c.DamagePotential += saved.damagePotential
+	c.DamageReceived += saved.damageReceived
+	c.Kills.Merge(saved.kills)
+	s.moveVictim(saved.cn, c.CN)
+
+	log.Printf("restored scores of %s (%d frags, %d deaths)", c, c.Frags, c.Deaths)
+}
+
+// tells everyone about the client's (restored) state
+func (s *Server) sendResume(c *Client) {
+	s.Clients.Broadcast(nmc.PlayerStateList, c.CN, c.State, c.Frags, c.Flags, c.Deaths, int32(c.QuadTimer.TimeLeft()/time.Millisecond), c.ToWire(), -1)
+}
+
+// Puts a joining client into its team, restoring the scores and team it had when it left the current game from the
+// same IP under the same name. Returns wether scores were restored.
+func (s *Server) rejoin(c *Client) bool {
+	saved := s.takeSavedState(addressKey(c))
+
+	if teamedMode, ok := s.GameMode.(game.TeamMode); ok {
+		if saved != nil {
+			teamedMode.Rejoin(&c.Player, saved.team)
+		} else {
+			teamedMode.Join(&c.Player) // may set client's team
+		}
+	}
+
+	if saved == nil {
+		// frags of a previous player with this CN don't count against this one
+		s.forgetVictim(c.CN)
+		return false
+	}
+	s.restoreState(c, saved)
+	return true
+}
+
+// Restores the scores a client had when it left the current game, after it authenticated under the same name.
+func (s *Server) rejoinAuthenticated(c *Client, domain, name string) {
+	if !c.Joined || s.Playback != nil {
+		return
+	}
+	saved := s.takeSavedState(authKey(domain, name))
+	if saved == nil {
+		return
+	}
+
+	if teamedMode, ok := s.GameMode.(game.TeamMode); ok && c.Team.Name != saved.team {
+		if c.State == playerstate.Alive {
+			// switching teams now would kill the player
+			c.PendingTeam = saved.team
+			c.Send(nmc.ServerMessage, fmt.Sprintf("you will be put back into team %s after your next death", cubecode.Blue(saved.team)))
+		} else {
+			teamedMode.ChangeTeam(&c.Player, saved.team, false)
+		}
+	}
+
+	s.restoreState(c, saved)
+	s.sendResume(c)
+}
+
+// Puts a client whose team could not be restored right away (because it was alive) back into its team. Called when a
+// player dies.
+func (s *Server) restorePendingTeam(c *Client) {
+	if c.PendingTeam == "" {
+		return
+	}
+	team := c.PendingTeam
+	c.PendingTeam = ""
+
+	if teamedMode, ok := s.GameMode.(game.TeamMode); ok && c.Team.Name != team && c.State != playerstate.Alive {
+		teamedMode.ChangeTeam(&c.Player, team, true)
+		s.checkTeamBalance()
+	}
+}
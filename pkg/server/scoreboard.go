@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+)
+
+// number of players listed per category at intermission
+const scoreboardSize = 3
+
+// Kills per death, counting zero deaths as one.
+func kpd(c *Client) float64 {
+	deaths := c.Deaths
+	if deaths < 1 {
+		deaths = 1
+	}
+	return float64(c.Frags) / float64(deaths)
+}
+
+// Percentage of the potential damage of all shots fired that was actually dealt.
+func accuracy(c *Client) float64 {
+	if c.DamagePotential <= 0 {
+		return 0
+	}
+	return float64(c.Damage) * 100 / float64(c.DamagePotential)
+}
+
+// Returns a line listing the best players by the given value, or an empty string if no player has a value above 0.
+func ranking(title string, players []*Client, value func(*Client) float64, format string) string {
+	ranked := make([]*Client, 0, len(players))
+	for _, c := range players {
+		if value(c) > 0 {
+			ranked = append(ranked, c)
+		}
+	}
+	if len(ranked) == 0 {
+		return ""
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return value(ranked[i]) > value(ranked[j]) })
+	if len(ranked) > scoreboardSize {
+		ranked = ranked[:scoreboardSize]
+	}
+
+	entries := make([]string, 0, len(ranked))
+	for _, c := range ranked {
+		entries = append(entries, fmt.Sprintf("%s %s", cubecode.Green(c.Name), fmt.Sprintf(format, value(c))))
+	}
+	return fmt.Sprintf("%s: %s", cubecode.Yellow(title), strings.Join(entries, ", "))
+}
+
+// Returns the teams of the current game, best first, and wether teams are ranked by score (rather than frags). Returns
+// nil outside of team modes.
+func (s *Server) rankedTeams() (teams []*game.Team, scoring bool) {
+	teamMode, ok := s.GameMode.(game.TeamMode)
+	if !ok {
+		return nil, false
+	}
+
+	_, flagMode := s.GameMode.(game.FlagMode)
+	_, captureMode := s.GameMode.(game.CaptureMode)
+	_, collectMode := s.GameMode.(game.CollectMode)
+	scoring = flagMode || captureMode || collectMode
+
+	teams = make([]*game.Team, 0, len(teamMode.Teams()))
+	for _, t := range teamMode.Teams() {
+		teams = append(teams, t)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		if scoring && teams[i].Score != teams[j].Score {
+			return teams[i].Score > teams[j].Score
+		}
+		if teams[i].Frags != teams[j].Frags {
+			return teams[i].Frags > teams[j].Frags
+		}
+		return teams[i].Name < teams[j].Name
+	})
+
+	return teams, scoring
+}
+
+// Builds the end-of-game summary: team totals in team modes, then the best players by frags, KPD and accuracy, and,
+// in flag modes, by flags scored and returned.
+func (s *Server) intermissionStats() (lines []string) {
+	var players []*Client
+	s.Clients.ForEach(func(c *Client) {
+		if c.Joined && c.State != playerstate.Spectator {
+			players = append(players, c)
+		}
+	})
+	if len(players) == 0 {
+		return
+	}
+
+	if teams, scoring := s.rankedTeams(); teams != nil {
+		totals := make([]string, 0, len(teams))
+		for _, t := range teams {
+			if scoring {
+				totals = append(totals, fmt.Sprintf("%s %d points, %d frags", cubecode.Blue(t.Name), t.Score, t.Frags))
+			} else {
+				totals = append(totals, fmt.Sprintf("%s %d frags", cubecode.Blue(t.Name), t.Frags))
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", cubecode.Yellow("teams"), strings.Join(totals, ", ")))
+	}
+
+	lines = append(lines,
+		ranking("top fraggers", players, func(c *Client) float64 { return float64(c.Frags) }, "%.0f"),
+		ranking("best KPD", players, kpd, "%.2f"),
+		ranking("best accuracy", players, accuracy, "%.0f%%"),
+	)
+
+	if _, ok := s.GameMode.(game.FlagMode); ok {
+		lines = append(lines,
+			ranking("most flags", players, func(c *Client) float64 { return float64(c.Flags) }, "%.0f"),
+			ranking("most returns", players, func(c *Client) float64 { return float64(c.FlagReturns) }, "%.0f"),
+		)
+	}
+
+	return
+}
+
+// Tells all clients about the best players of the game that just ended.
+func (s *Server) BroadcastIntermissionStats() {
+	for _, line := range s.intermissionStats() {
+		if line != "" {
+			s.Clients.Broadcast(nmc.ServerMessage, line)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -13,11 +15,13 @@ import (
 
 	"github.com/sauerbraten/waiter/internal/relay"
 	"github.com/sauerbraten/waiter/pkg/bans"
+	"github.com/sauerbraten/waiter/pkg/demo"
 	"github.com/sauerbraten/waiter/pkg/enet"
 	"github.com/sauerbraten/waiter/pkg/game"
 	"github.com/sauerbraten/waiter/pkg/geoip"
 	"github.com/sauerbraten/waiter/pkg/geom"
 	"github.com/sauerbraten/waiter/pkg/maprot"
+	"github.com/sauerbraten/waiter/pkg/ogz"
 	"github.com/sauerbraten/waiter/pkg/protocol"
 	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
 	"github.com/sauerbraten/waiter/pkg/protocol/disconnectreason"
@@ -25,7 +29,9 @@ import (
 	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
 	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
 	"github.com/sauerbraten/waiter/pkg/protocol/role"
+	"github.com/sauerbraten/waiter/pkg/protocol/sound"
 	"github.com/sauerbraten/waiter/pkg/protocol/weapon"
+	"github.com/sauerbraten/waiter/pkg/stats"
 )
 
 type Server struct {
@@ -42,12 +48,25 @@ type Server struct {
 	PendingMapChange *time.Timer
 	callbacks        chan<- func()
 	rng              *rand.Rand
+	recording        *recording // nil when no demo is being recorded
+	Demos            []*Demo    // the most recently recorded games, oldest first
+	DemoArchive      *demo.Archive
+	Playback         *Playback              // non-nil when the server replays a demo instead of hosting games
+	savedStates      map[string]*savedState // scores of players who left the current game, by IP and name or auth name
+	pendingBalance   *time.Timer            // fires when teams stayed unbalanced for a while
+	balanceMove      *balanceMove           // player picked to be moved to another team at their next death
+	PlayerStats      *stats.Store           // lifetime statistics of authenticated players; nil if disabled
 
 	// non-standard stuff
 	Commands        *ServerCommands
 	KeepTeams       bool
+	SkillShuffle    bool // shuffle teams by skill instead of randomly (unless teams are kept)
+	AutoBalance     bool
 	CompetitiveMode bool
+	Overtime        game.Overtime
 	ReportStats     bool
+	RecordDemos     bool
+	MapCRCs         MapCRCs
 }
 
 func New(host *enet.Host, conf *Config, banManager *bans.BanManager, commands ...*ServerCommand) (*Server, <-chan func()) {
@@ -68,6 +87,15 @@ func New(host *enet.Host, conf *Config, banManager *bans.BanManager, commands ..
 		MapRotation: maprot.NewRotation(conf.MapPools),
 		callbacks:   callbacks,
 		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		Overtime:    conf.DefaultOvertime,
+		RecordDemos: conf.RecordDemos,
+		AutoBalance: conf.AutoBalance,
+		savedStates: map[string]*savedState{},
+		DemoArchive: &demo.Archive{
+			Dir:     conf.DemosDirectory,
+			MaxAge:  conf.DemoArchiveMaxAge,
+			MaxSize: conf.DemoArchiveMaxSize * 1024 * 1024,
+		},
 	}
 
 	s.Commands = NewCommands(s, commands...)
@@ -150,7 +178,13 @@ func (s *Server) TryJoin(c *Client, name string, playerModel int32, authDomain,
 
 // Puts a client into the current game, using the data the client provided with his nmc.TryJoin packet.
 func (s *Server) Join(c *Client) {
+	if s.Playback != nil {
+		s.Playback.join(c)
+		return
+	}
+
 	c.Joined = true
+	c.JoinTime = time.Now()
 
 	if s.MasterMode == mastermode.Locked {
 		c.State = playerstate.Spectator
@@ -159,14 +193,13 @@ func (s *Server) Join(c *Client) {
 		s.Spawn(c)
 	}
 
-	if teamedMode, ok := s.GameMode.(game.TeamMode); ok {
-		teamedMode.Join(&c.Player) // may set client's team
-	}
-	s.SendWelcome(c) // tells client about her team
-	if flagMode, ok := s.GameMode.(game.FlagMode); ok {
-		c.Send(nmc.InitFlags, flagMode.FlagsInitPacket()...)
-	}
+	restored := s.rejoin(c) // may set client's team
+	s.SendWelcome(c)        // tells client about her team
+	s.sendModeState(c.Send)
 	s.Clients.InformOthersOfJoin(c)
+	if restored {
+		s.sendResume(c)
+	}
 
 	sessionID := c.SessionID
 	go func() {
@@ -186,6 +219,8 @@ func (s *Server) Join(c *Client) {
 
 	c.Send(nmc.ServerMessage, s.MessageOfTheDay)
 	c.Send(nmc.RequestAuth, s.StatsServerAuthDomain)
+
+	s.checkTeamBalance()
 }
 
 func (s *Server) Broadcast(typ nmc.ID, args ...interface{}) {
@@ -207,22 +242,55 @@ func (s *Server) ConfirmSpawn(client *Client, lifeSequence, _weapon int32) {
 		return
 	}
 
+	if weapon.ID(_weapon) != weapon.Saw && client.Ammo[weapon.ID(_weapon)] <= 0 {
+		s.Violation(client, fmt.Sprintf("spawned with weapon %d without ammo for it", _weapon))
+		return
+	}
+
 	client.State = playerstate.Alive
 	client.SelectedWeapon = weapon.ByID(weapon.ID(_weapon))
 	client.LastSpawnAttempt = time.Time{}
 
 	client.Packets.Publish(nmc.ConfirmSpawn, client.ToWire())
 
-	if clock, competitive := s.GameMode.(game.Competitive); competitive {
+	if clock, competitive := s.Clock.(game.Competitive); competitive {
 		clock.Spawned(&client.Player)
 	}
 }
 
+func (s *Server) SetSpectator(c *Client, spectate bool) {
+	if (c.State == playerstate.Spectator) == spectate {
+		// nothing to do
+		return
+	}
+	if spectate {
+		if c.State == playerstate.Alive {
+			s.GameMode.HandleFrag(&c.Player, &c.Player)
+		}
+		s.GameMode.Leave(&c.Player)
+		s.Clock.Leave(&c.Player)
+		c.State = playerstate.Spectator
+	} else {
+		c.State = playerstate.Dead
+		if teamedMode, ok := s.GameMode.(game.TeamMode); ok {
+			teamedMode.Join(&c.Player)
+		}
+	}
+	s.Clients.Broadcast(nmc.Spectator, c.CN, spectate)
+	s.checkTeamBalance()
+}
+
 func (s *Server) Disconnect(client *Client, reason disconnectreason.ID) {
+	s.saveState(client)
 	s.GameMode.Leave(&client.Player)
 	s.Clock.Leave(&client.Player)
 	s.relay.RemoveClient(client.CN)
-	s.Clients.Disconnect(client, reason)
+	if s.Playback == nil {
+		s.Clients.Disconnect(client, reason)
+	} else {
+		// other clients only know the recorded players, so they must not be told about this client leaving
+		log.Printf("%s (%s) disconnected", client, client.Peer.Address.IP)
+	}
 	s.Clients.ForEach(func(c *Client) { log.Printf("%#v\n", c) })
 	s.host.Disconnect(client.Peer, reason)
 	client.Reset()
@@ -232,6 +300,7 @@ func (s *Server) Disconnect(client *Client, reason disconnectreason.ID) {
 	if s.Clients.NumberOfClientsConnected() == 0 {
 		s.Empty()
 	}
+	s.checkTeamBalance()
 }
 
 func (s *Server) Kick(client *Client, victim *Client, reason string) {
@@ -264,11 +333,19 @@ func (s *Server) Unsupervised() {
 	s.Clock.Resume(nil)
 	s.MasterMode = mastermode.Auth
 	s.KeepTeams = false
+	s.SkillShuffle = false
 	s.CompetitiveMode = false
+	s.Overtime = s.DefaultOvertime
 	s.ReportStats = true
+	s.RecordDemos = s.Config.RecordDemos
+	s.AutoBalance = s.Config.AutoBalance
 }
 
 func (s *Server) Empty() {
+	if s.Playback != nil {
+		s.Playback.reset()
+		return
+	}
 	s.MapRotation.ClearQueue()
 	s.StartGame(s.StartMode(s.FallbackGameModeID), s.Map)
 }
@@ -282,8 +359,13 @@ func (s *Server) Intermission() {
 		s.StartGame(s.StartMode(s.GameMode.ID()), nextMap)
 	})
 
+	s.BroadcastIntermissionStats()
+	s.recordPlayerStats()
+	s.logFragMatrix()
 	s.Clients.Broadcast(nmc.ServerMessage, "next up: "+nextMap)
 
+	s.stopDemoRecording()
+
 	if s.StatsServer != nil && s.ReportStats && s.NumClients() > 0 {
 		if s.StatsServer.HasExtension(mprotocol.SuccStats) {
 			s.ReportEndgameStats()
@@ -291,6 +373,19 @@ func (s *Server) Intermission() {
 	}
 }
 
+// Plays a sound at the player's position for all other clients.
+func (s *Server) PlaySound(p *game.Player, snd sound.ID) {
+	c := s.Clients.GetClientByCN(p.CN)
+	if c == nil || c.Peer == nil {
+		return
+	}
+	c.Packets.Publish(nmc.Sound, snd)
+}
+
+func (s *Server) ScoreChanged() { s.Clock.ScoreChanged() }
+
+func (s *Server) Synchronize(f func()) { s.callbacks <- f }
+
 // Returns the number of connected clients playgin (i.e. joined and not spectating)
 func (s *Server) NumberOfPlayers() (n int) {
 	s.Clients.ForEach(func(c *Client) {
@@ -339,13 +434,15 @@ func (s *Server) ReAuthClients(domain string) {
 }
 
 func (s *Server) StartGame(mode game.Mode, mapname string) {
+	s.stopDemoRecording()
+
 	if s.Clock != nil {
 		s.Clock.CleanUp()
 	}
 	if s.CompetitiveMode {
-		s.Clock = game.NewCompetitiveClock(s, mode)
+		s.Clock = game.NewCompetitiveClock(s, mode, s.Overtime)
 	} else {
-		s.Clock = game.NewCasualClock(s, mode)
+		s.Clock = game.NewCasualClock(s, mode, s.Overtime)
 	}
 
 	// stop any pending map change
@@ -359,19 +456,74 @@ func (s *Server) StartGame(mode game.Mode, mapname string) {
 	}
 
 	s.Map = mapname
+	mapFile := s.loadMapFile(mapname)
+	s.MapCRC = s.expectedMapCRC(mapname, mapFile)
+	s.clearSavedStates()
+	s.cancelBalance()
 	s.GameMode = mode
 
 	if teamedMode, ok := s.GameMode.(game.TeamMode); ok {
-		s.ForEachPlayer(teamedMode.Join)
+		if s.SkillShuffle && !s.KeepTeams {
+			s.shuffleTeamsBySkill(teamedMode)
+		} else {
+			s.ForEachPlayer(teamedMode.Join)
+		}
 	}
 
+	s.loadMapEntities(mapFile)
+
 	s.Broadcast(nmc.MapChange, s.Map, s.GameMode.ID(), s.GameMode.NeedsMapInfo())
+	if !s.GameMode.NeedsMapInfo() {
+		// entities were loaded from the map file, clients won't send them
+		if pickupMode, ok := s.GameMode.(game.PickupMode); ok {
+			s.Broadcast(nmc.PickupList, pickupMode.PickupsInitPacket()...)
+		}
+		if flagMode, ok := s.GameMode.(game.FlagMode); ok {
+			s.Broadcast(nmc.InitFlags, flagMode.FlagsInitPacket()...)
+		}
+	}
 	s.Clock.Start()
 	s.MapChange()
 
+	s.startDemoRecording()
+
 	s.Clients.Broadcast(nmc.ServerMessage, s.MessageOfTheDay)
 }
 
+// Sets up the game mode's pickups and flags from the map file, if there is one in the configured maps directory.
+// Reads the map's file from the maps directory, once per map change: it provides both the map's CRC and its entities.
+// Returns nil if the file is not available. If the file could not be parsed, only the map's CRC is set.
+func (s *Server) loadMapFile(mapname string) *ogz.Map {
+	if s.MapsDirectory == "" {
+		return nil
+	}
+	if filepath.Base(mapname) != mapname {
+		log.Printf("not loading map file for '%s': invalid map name", mapname)
+		return nil
+	}
+
+	m, err := ogz.Load(filepath.Join(s.MapsDirectory, mapname+".ogz"))
+	if m == nil {
+		if !os.IsNotExist(err) {
+			log.Printf("could not load map file for '%s': %v", mapname, err)
+		}
+		return nil
+	}
+	if err != nil {
+		log.Printf("could not parse map file for '%s', will use entities sent by clients: %v", mapname, err)
+	}
+	return m
+}
+
+func (s *Server) loadMapEntities(m *ogz.Map) {
+	mode, ok := s.GameMode.(game.MapEntitiesMode)
+	if !ok || m == nil || m.Entities == nil {
+		return
+	}
+
+	mode.LoadMapEntities(m.Entities)
+}
+
 func (s *Server) SetMasterMode(c *Client, mm mastermode.ID) {
 	if mm < mastermode.Open || mm > mastermode.Private {
 		log.Println("invalid mastermode", mm, "requested")
@@ -397,9 +549,36 @@ type hit struct {
 	dir          *geom.Vector
 }
 
+// shots may arrive bunched up because of network jitter; a shot arriving late allows the next one to arrive early by up
+// to this much
+const reloadJitterTolerance = 100 * time.Millisecond
+
 func (s *Server) HandleShoot(client *Client, wpn weapon.Weapon, id int32, from, to *geom.Vector, hits []hit) {
-	from = from.Mul(geom.DMF)
-	to = to.Mul(geom.DMF)
+	if client.State != playerstate.Alive {
+		return
+	}
+	if wpn.ID != client.SelectedWeapon.ID {
+		s.Violation(client, fmt.Sprintf("shot weapon %d while holding weapon %d", wpn.ID, client.SelectedWeapon.ID))
+		return
+	}
+	if wpn.ID != weapon.Saw && client.Ammo[wpn.ID] <= 0 {
+		s.Violation(client, fmt.Sprintf("shot weapon %d without ammo", wpn.ID))
+		return
+	}
+	now := time.Now()
+	if now.Before(client.GunReloadEnd) {
+		s.Violation(client, fmt.Sprintf("shot weapon %d %s before reload finished", wpn.ID, client.GunReloadEnd.Sub(now)))
+		return
+	}
+
+	reloadStart := client.GunReloadEnd
+	if earliest := now.Add(-reloadJitterTolerance); reloadStart.Before(earliest) {
+		reloadStart = earliest
+	}
+	client.GunReloadEnd = reloadStart.Add(time.Duration(wpn.ReloadTime) * time.Millisecond)
+	client.LastShot = now
+
+	_from, _to := from.Mul(geom.DMF), to.Mul(geom.DMF)
 
 	s.Clients.Relay(
 		client,
@@ -407,23 +586,24 @@ func (s *Server) HandleShoot(client *Client, wpn weapon.Weapon, id int32, from,
 		client.CN,
 		wpn.ID,
 		id,
-		from.X(),
-		from.Y(),
-		from.Z(),
-		to.X(),
-		to.Y(),
-		to.Z(),
+		_from.X(),
+		_from.Y(),
+		_from.Z(),
+		_to.X(),
+		_to.Y(),
+		_to.Z(),
 	)
-	client.LastShot = time.Now()
-	client.DamagePotential += wpn.Damage * wpn.Rays // TODO: quad damage
+	client.DamagePotential += wpn.Damage * client.DamageScale() * wpn.Rays
 	if wpn.ID != weapon.Saw {
 		client.Ammo[wpn.ID]--
 	}
 	switch wpn.ID {
 	case weapon.GrenadeLauncher, weapon.RocketLauncher:
 		// wait for nmc.Explode pkg
+		client.AddProjectile(id, wpn)
 	default:
 		// apply damage
+		plausibleOrigin := s.plausibleShotOrigin(client, from)
 		rays := int32(0)
 		for _, h := range hits {
 			target := s.Clients.GetClientByCN(h.target)
@@ -440,8 +620,13 @@ func (s *Server) HandleShoot(client *Client, wpn weapon.Weapon, id int32, from,
 				continue
 			}
 
-			damage := h.rays * wpn.Damage
-			// TODO: quad damage
+			if !plausibleOrigin || !s.plausibleHit(client, target, wpn, from, to) {
+				client.RejectedHits++
+				log.Printf("rejected hit by %s on %s with weapon %d (%d rejected so far)", client, target, wpn.ID, client.RejectedHits)
+				continue
+			}
+
+			damage := h.rays * wpn.Damage * client.DamageScale()
 
 			s.applyDamage(client, target, int32(damage), wpn.ID, h.dir)
 		}
@@ -449,7 +634,10 @@ func (s *Server) HandleShoot(client *Client, wpn weapon.Weapon, id int32, from,
 }
 
 func (s *Server) HandleExplode(client *Client, millis int32, wpn weapon.Weapon, id int32, hits []hit) {
-	// TODO: delete stored projectile
+	if !client.RemoveProjectile(id, wpn.ID) {
+		// unknown projectile, or it already exploded
+		return
+	}
 
 	s.Clients.Relay(
 		client,
@@ -478,8 +666,7 @@ hits:
 			}
 		}
 
-		damage := float64(wpn.Damage)
-		// TODO: quad damage
+		damage := float64(wpn.Damage * client.DamageScale())
 		damage *= (1 - h.distance/weapon.ExplosionDistanceScale/wpn.ExplosionRadius)
 		if target == client {
 			damage *= weapon.ExplosionSelfDamageScale
@@ -492,8 +679,8 @@ hits:
 func (s *Server) applyDamage(attacker, victim *Client, damage int32, wpnID weapon.ID, dir *geom.Vector) {
 	victim.ApplyDamage(&attacker.Player, damage, wpnID, dir)
 	s.Clients.Broadcast(nmc.Damage, victim.CN, attacker.CN, damage, victim.Armour, victim.Health)
-	// TODO: setpushed ???
 	if !dir.IsZero() {
+		victim.LastPushed = time.Now()
 		dir = dir.Scale(geom.DNF)
 		typ, p := nmc.HitPush, []interface{}{victim.CN, wpnID, damage, dir.X(), dir.Y(), dir.Z()}
 		if victim.Health <= 0 {
@@ -503,7 +690,7 @@ func (s *Server) applyDamage(attacker, victim *Client, damage int32, wpnID weapo
 		}
 	}
 	if victim.Health <= 0 {
-		s.GameMode.HandleFrag(&attacker.Player, &victim.Player)
+		s.handleFrag(attacker, victim)
 	}
 }
 
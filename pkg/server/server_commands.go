@@ -6,7 +6,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sauerbraten/waiter/pkg/game"
 	"github.com/sauerbraten/waiter/pkg/protocol/cubecode"
+	"github.com/sauerbraten/waiter/pkg/protocol/gamemode"
 	"github.com/sauerbraten/waiter/pkg/protocol/mastermode"
 	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
 	"github.com/sauerbraten/waiter/pkg/protocol/role"
@@ -152,6 +154,9 @@ var ToggleKeepTeams = &ServerCommand{
 			}
 			changed = s.KeepTeams != (val == 1)
 			s.KeepTeams = val == 1
+			if s.KeepTeams {
+				s.SkillShuffle = false
+			}
 		}
 		if changed {
 			if s.KeepTeams {
@@ -169,6 +174,50 @@ var ToggleKeepTeams = &ServerCommand{
 	},
 }
 
+var SetShuffleMode = &ServerCommand{
+	name:        "shuffle",
+	argsFormat:  "random|skill",
+	aliases:     []string{"shuffleteams"},
+	description: "sets how teams are shuffled on map change: randomly, or into teams of equal skill (players put into a team by a master stay in it)",
+	minRole:     role.Master,
+	f: func(s *Server, c *Client, args []string) {
+		mode := func() string {
+			switch {
+			case s.KeepTeams:
+				return "teams will be kept"
+			case s.SkillShuffle:
+				return "teams will be shuffled by skill"
+			default:
+				return "teams will be shuffled randomly"
+			}
+		}
+
+		if len(args) < 1 {
+			c.Send(nmc.ServerMessage, mode())
+			return
+		}
+
+		var skill bool
+		switch strings.ToLower(args[0]) {
+		case "random":
+			skill = false
+		case "skill":
+			skill = true
+		default:
+			c.Send(nmc.ServerMessage, cubecode.Fail("usage: #shuffle random|skill"))
+			return
+		}
+
+		if s.SkillShuffle == skill && !s.KeepTeams {
+			c.Send(nmc.ServerMessage, mode())
+			return
+		}
+		s.SkillShuffle = skill
+		s.KeepTeams = false
+		s.Clients.Broadcast(nmc.ServerMessage, mode())
+	},
+}
+
 var ToggleCompetitiveMode = &ServerCommand{
 	name:        "competitive",
 	argsFormat:  "0|1",
@@ -209,6 +258,133 @@ var ToggleCompetitiveMode = &ServerCommand{
 	},
 }
 
+var SetOvertime = &ServerCommand{
+	name:        "overtime",
+	argsFormat:  "off|<duration>|suddendeath",
+	aliases:     []string{"ot", "goldengoal"},
+	description: "decides games that are tied when the time runs out, by extending them by the duration or until the next score",
+	minRole:     role.Master,
+	f: func(s *Server, c *Client, args []string) {
+		changed := false
+		if len(args) >= 1 {
+			ot, err := game.ParseOvertime(strings.Join(args, " "))
+			if err != nil {
+				c.Send(nmc.ServerMessage, cubecode.Fail("could not parse overtime: "+err.Error()))
+				return
+			}
+			changed = s.Overtime != ot
+			s.Overtime = ot
+		}
+		if changed {
+			s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("overtime will be %s with next game", s.Overtime))
+		} else {
+			c.Send(nmc.ServerMessage, fmt.Sprintf("overtime is %s", s.Overtime))
+		}
+	},
+}
+
+var ToggleDemoRecording = &ServerCommand{
+	name:        "recorddemo",
+	argsFormat:  "0|1",
+	aliases:     []string{"demo"},
+	description: "when enabled, games are recorded into demo files, starting with the next game",
+	minRole:     role.Master,
+	f: func(s *Server, c *Client, args []string) {
+		if len(args) >= 1 {
+			val, err := strconv.Atoi(args[0])
+			if err != nil || (val != 0 && val != 1) {
+				return
+			}
+			if s.RecordDemos != (val == 1) {
+				s.SetRecordDemos(val == 1)
+				return
+			}
+		}
+		if s.RecordDemos {
+			c.Send(nmc.ServerMessage, "demo recording is on")
+		} else {
+			c.Send(nmc.ServerMessage, "demo recording is off")
+		}
+	},
+}
+
+// maximum number of demos listed by the demos command
+const maxListedDemos = 10
+
+var ListArchivedDemos = &ServerCommand{
+	name:        "demos",
+	argsFormat:  "[query]",
+	aliases:     []string{"archive"},
+	description: "lists the most recent archived demos, optionally only those with a map, mode or player matching the query",
+	minRole:     role.None,
+	f: func(s *Server, c *Client, args []string) {
+		metas, err := s.DemoArchive.List()
+		if err != nil {
+			c.Send(nmc.ServerMessage, cubecode.Error("could not read demo archive: "+err.Error()))
+			return
+		}
+
+		query := strings.Join(args, " ")
+		listed := 0
+		for _, meta := range metas {
+			if query != "" && !meta.Matches(query) {
+				continue
+			}
+			players := make([]string, 0, len(meta.Players))
+			for _, p := range meta.Players {
+				players = append(players, p.Name)
+			}
+			c.Send(nmc.ServerMessage, fmt.Sprintf("%s: %s on %s (%s), %s",
+				cubecode.Green(meta.File),
+				meta.Mode,
+				meta.Map,
+				time.Duration(meta.Duration)*time.Second,
+				strings.Join(players, ", "),
+			))
+			listed++
+			if listed == maxListedDemos {
+				break
+			}
+		}
+		if listed == 0 {
+			c.Send(nmc.ServerMessage, "no archived demos found")
+		}
+	},
+}
+
+var ToggleAutoBalance = &ServerCommand{
+	name:        "autobalance",
+	argsFormat:  "0|1",
+	aliases:     []string{"balance"},
+	description: "when enabled, players are moved to the smaller team when teams are unbalanced, and team switches that would unbalance teams are refused",
+	minRole:     role.Master,
+	f: func(s *Server, c *Client, args []string) {
+		changed := false
+		if len(args) >= 1 {
+			val, err := strconv.Atoi(args[0])
+			if err != nil || (val != 0 && val != 1) {
+				return
+			}
+			changed = s.AutoBalance != (val == 1)
+			s.AutoBalance = val == 1
+		}
+		if changed {
+			s.checkTeamBalance()
+			if s.AutoBalance {
+				s.Clients.Broadcast(nmc.ServerMessage, "teams will be balanced automatically")
+			} else {
+				s.Clients.Broadcast(nmc.ServerMessage, "teams will not be balanced automatically")
+			}
+		} else {
+			if s.AutoBalance {
+				c.Send(nmc.ServerMessage, "auto-balancing is on")
+			} else {
+				c.Send(nmc.ServerMessage, "auto-balancing is off")
+			}
+		}
+	},
+}
+
 var ToggleReportStats = &ServerCommand{
 	name:        "reportstats",
 	argsFormat:  "0|1",
@@ -241,6 +417,27 @@ var ToggleReportStats = &ServerCommand{
 	},
 }
 
+var ListRejectedHits = &ServerCommand{
+	name:        "rejectedhits",
+	argsFormat:  "",
+	aliases:     []string{"rejected", "hitcheck"},
+	description: "lists players with hits that were rejected because they were geometrically impossible",
+	minRole:     role.Admin,
+	f: func(s *Server, c *Client, args []string) {
+		rejected := []string{}
+		s.Clients.ForEach(func(_c *Client) {
+			if _c.RejectedHits > 0 {
+				rejected = append(rejected, fmt.Sprintf("%s: %d", s.Clients.UniqueName(_c), _c.RejectedHits))
+			}
+		})
+		if len(rejected) == 0 {
+			c.Send(nmc.ServerMessage, "no hits were rejected")
+			return
+		}
+		c.Send(nmc.ServerMessage, "rejected hits: "+strings.Join(rejected, ", "))
+	},
+}
+
 var LookupIPs = &ServerCommand{
 	name:        "ip",
 	argsFormat:  "[name|cn]...",
@@ -252,16 +449,7 @@ var LookupIPs = &ServerCommand{
 			args = []string{c.Name}
 		}
 		for _, query := range args {
-			var target *Client
-			// try CN
-			cn, err := strconv.Atoi(query)
-			if err == nil {
-				target = s.Clients.GetClientByCN(uint32(cn))
-			}
-			if err != nil || target == nil {
-				target = s.Clients.FindClientByName(query)
-			}
-
+			target := s.findClient(query)
 			if target != nil {
 				c.Send(nmc.ServerMessage, fmt.Sprintf("%s has IP %s", s.Clients.UniqueName(target), target.Peer.Address.IP))
 			} else {
@@ -271,6 +459,183 @@ var LookupIPs = &ServerCommand{
 	},
 }
 
+// finds a connected client by CN or (part of) its name
+func (s *Server) findClient(query string) *Client {
+	var target *Client
+	// try CN
+	cn, err := strconv.Atoi(query)
+	if err == nil {
+		target = s.Clients.GetClientByCN(uint32(cn))
+	}
+	if err != nil || target == nil || target.Peer == nil {
+		target = s.Clients.FindClientByName(query)
+	}
+	return target
+}
+
+var PrintStats = &ServerCommand{
+	name:        "stats",
+	argsFormat:  "[name|cn]",
+	aliases:     []string{"stat", "st"},
+	description: "prints statistics of the player identified by name or cn in the current game, or your own when called with no argument",
+	minRole:     role.None,
+	f: func(s *Server, c *Client, args []string) {
+		target := c
+		if len(args) >= 1 {
+			target = s.findClient(args[0])
+			if target == nil {
+				c.Send(nmc.ServerMessage, fmt.Sprintf("could not find a client matching '%s'", args[0]))
+				return
+			}
+		}
+
+		stats := []string{
+			fmt.Sprintf("frags %d", target.Frags),
+			fmt.Sprintf("deaths %d", target.Deaths),
+			fmt.Sprintf("teamkills %d", target.Teamkills),
+			fmt.Sprintf("KPD %.2f", kpd(target)),
+			fmt.Sprintf("accuracy %.0f%%", accuracy(target)),
+			fmt.Sprintf("damage dealt %d", target.Damage),
+			fmt.Sprintf("damage received %d", target.DamageReceived),
+		}
+		if _, ok := s.GameMode.(game.FlagMode); ok {
+			stats = append(stats, fmt.Sprintf("flags %d", target.Flags))
+		}
+		stats = append(stats, fmt.Sprintf("streak %d", target.Streak))
+
+		c.Send(nmc.ServerMessage, fmt.Sprintf("%s: %s", cubecode.Green(s.Clients.UniqueName(target)), strings.Join(stats, ", ")))
+	},
+}
+
+var PrintLeaderboard = &ServerCommand{
+	name:        "top",
+	argsFormat:  "[mode] [frags|kpd|acc|flags]",
+	aliases:     []string{"best", "leaderboard"},
+	description: "lists the best authenticated players of a mode (the current one by default) by lifetime frags (default), KPD, accuracy or flags",
+	minRole:     role.None,
+	f: func(s *Server, c *Client, args []string) {
+		if s.PlayerStats == nil {
+			c.Send(nmc.ServerMessage, cubecode.Fail("player statistics are disabled on this server"))
+			return
+		}
+
+		cat := leaderboardCategories[0]
+		if len(args) >= 1 {
+			if _cat := findLeaderboardCategory(args[len(args)-1]); _cat != nil {
+				cat = _cat
+				args = args[:len(args)-1]
+			}
+		}
+
+		mode := s.GameMode.ID()
+		if len(args) >= 1 {
+			mode = gamemode.Parse(strings.Join(args, " "))
+			if !gamemode.Valid(mode) {
+				c.Send(nmc.ServerMessage, cubecode.Fail(fmt.Sprintf("unknown mode or category '%s'", strings.Join(args, " "))))
+				return
+			}
+		}
+
+		for _, line := range s.leaderboard(mode, cat) {
+			c.Send(nmc.ServerMessage, line)
+		}
+	},
+}
+
+var PrintRank = &ServerCommand{
+	name:        "rank",
+	argsFormat:  "[name|cn]",
+	aliases:     []string{},
+	description: "prints where the player identified by auth name, name or cn (yourself by default) stands in the current mode's leaderboards",
+	minRole:     role.None,
+	f: func(s *Server, c *Client, args []string) {
+		if s.PlayerStats == nil {
+			c.Send(nmc.ServerMessage, cubecode.Fail("player statistics are disabled on this server"))
+			return
+		}
+
+		name, ok := s.lookupStatsName(c, args)
+		if !ok {
+			return
+		}
+
+		c.Send(nmc.ServerMessage, s.rank(name))
+	},
+}
+
+var PrintRating = &ServerCommand{
+	name:        "rating",
+	argsFormat:  "[name|cn]",
+	aliases:     []string{"elo", "skill"},
+	description: "prints the skill rating of the player identified by auth name, name or cn (yourself by default)",
+	minRole:     role.None,
+	f: func(s *Server, c *Client, args []string) {
+		if s.PlayerStats == nil {
+			c.Send(nmc.ServerMessage, cubecode.Fail("player statistics are disabled on this server"))
+			return
+		}
+
+		name, ok := s.lookupStatsName(c, args)
+		if !ok {
+			return
+		}
+
+		rating, games := s.PlayerStats.Rating(s.StatsServerAuthDomain, name)
+		c.Send(nmc.ServerMessage, fmt.Sprintf("%s: rating %.0f (%d rated games)", cubecode.Green(name), rating, games))
+	},
+}
+
+// Returns the stats server auth name of the player identified by the first argument (a connected client's name or CN,
+// or an auth name), or the requesting client's when called without arguments. Tells the requesting client when there
+// is no such name.
+func (s *Server) lookupStatsName(c *Client, args []string) (string, bool) {
+	if len(args) < 1 {
+		name, ok := s.statsName(c)
+		if !ok {
+			c.Send(nmc.ServerMessage, cubecode.Fail("you have to be authenticated with "+s.StatsServerAuthDomain+" to be ranked"))
+		}
+		return name, ok
+	}
+
+	target := s.findClient(args[0])
+	if target == nil {
+		return args[0], true
+	}
+	name, ok := s.statsName(target)
+	if !ok {
+		c.Send(nmc.ServerMessage, cubecode.Fail(fmt.Sprintf("%s is not authenticated with %s", s.Clients.UniqueName(target), s.StatsServerAuthDomain)))
+	}
+	return name, ok
+}
+
+var PrintHeadToHead = &ServerCommand{
+	name:        "vs",
+	argsFormat:  "<name|cn>",
+	aliases:     []string{"h2h", "headtohead"},
+	description: "prints your frags of and deaths by the player identified by name or cn in the current game",
+	minRole:     role.None,
+	f: func(s *Server, c *Client, args []string) {
+		if len(args) < 1 {
+			return
+		}
+		target := s.findClient(args[0])
+		if target == nil {
+			c.Send(nmc.ServerMessage, fmt.Sprintf("could not find a client matching '%s'", args[0]))
+			return
+		}
+		if target == c {
+			c.Send(nmc.ServerMessage, cubecode.Fail("you can't play against yourself"))
+			return
+		}
+
+		c.Send(nmc.ServerMessage, fmt.Sprintf("you vs %s: %s frags, %s deaths",
+			cubecode.Green(s.Clients.UniqueName(target)),
+			describeKills(c.Kills, target.CN),
+			describeKills(target.Kills, c.CN),
+		))
+	},
+}
+
 var SetTimeLeft = &ServerCommand{
 	name:        "settime",
 	argsFormat:  "[Xm][Ys]",
@@ -299,6 +664,51 @@ var SetTimeLeft = &ServerCommand{
 	},
 }
 
+var SeekPlayback = &ServerCommand{
+	name:        "seek",
+	argsFormat:  "[+|-]<duration>",
+	aliases:     []string{"goto"},
+	description: "jumps to a position in the demo being played back (e.g. 5m30s), or skips forward or back when prefixed with + or -",
+	minRole:     role.None, // only registered in playback mode, where everyone watching may control the demo
+	f: func(s *Server, c *Client, args []string) {
+		if len(args) < 1 || s.Playback == nil {
+			return
+		}
+
+		arg, relative := args[0], strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-")
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			c.Send(nmc.ServerMessage, cubecode.Error("could not parse duration: "+err.Error()))
+			return
+		}
+
+		pos := d
+		if relative {
+			pos = s.Playback.position() + d
+		}
+		s.Playback.Seek(pos)
+		s.Broadcast(nmc.ServerMessage, fmt.Sprintf("%s jumped to %s", s.Clients.UniqueName(c), s.Playback.position().Round(time.Second)))
+	},
+}
+
+var PausePlayback = &ServerCommand{
+	name:        "pause",
+	argsFormat:  "0|1",
+	description: "pauses or resumes the demo being played back",
+	minRole:     role.None, // only registered in playback mode, where everyone watching may control the demo
+	f: func(s *Server, c *Client, args []string) {
+		if len(args) < 1 || s.Playback == nil {
+			return
+		}
+		switch args[0] {
+		case "1":
+			s.Clock.Pause(&c.Player)
+		case "0":
+			s.Clock.Resume(&c.Player)
+		}
+	},
+}
+
 var RegisterPubkey = &ServerCommand{
 	name:        "register",
 	argsFormat:  "[name] pubkey",
@@ -368,16 +778,7 @@ var CheckAuthStatus = &ServerCommand{
 		}
 
 		for _, query := range args {
-			var target *Client
-			// try CN
-			cn, err := strconv.Atoi(query)
-			if err == nil {
-				target = s.Clients.GetClientByCN(uint32(cn))
-			}
-			if err != nil || target == nil {
-				target = s.Clients.FindClientByName(query)
-			}
-
+			target := s.findClient(query)
 			if target != nil {
 				if len(c.Authentications) == 0 {
 					c.Send(nmc.ServerMessage, fmt.Sprintf("%s has not authenticated", s.Clients.UniqueName(target)))
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+	"github.com/sauerbraten/waiter/pkg/protocol/playerstate"
+	"github.com/sauerbraten/waiter/pkg/stats"
+)
+
+// Estimates the skill of the given clients on the rating scale: the rating for players with rated games, otherwise
+// their lifetime KPD in the current mode (with any auth domain), otherwise their frags in the current (or just ended)
+// game compared to the average of the given clients.
+func (s *Server) skills(clients []*Client) map[*Client]float64 {
+	avgFrags := 0.0
+	for _, c := range clients {
+		avgFrags += float64(c.Frags)
+	}
+	if len(clients) > 0 {
+		avgFrags /= float64(len(clients))
+	}
+
+	skills := map[*Client]float64{}
+	for _, c := range clients {
+		skills[c] = s.skill(c, avgFrags)
+	}
+	return skills
+}
+
+// lowest ratio of KPD or frags to the average considered, so players with no or negative frags get a finite skill
+const minSkillRatio = 0.01
+
+// a player with ten times the KPD or frags of another is rated 400 points higher, like in Elo
+func ratingFromRatio(ratio float64) float64 {
+	if !(ratio >= minSkillRatio) { // also catches NaN
+		ratio = minSkillRatio
+	}
+	return stats.DefaultRating + 400*math.Log10(ratio)
+}
+
+func (s *Server) skill(c *Client, avgFrags float64) float64 {
+	if s.PlayerStats != nil {
+		if name, ok := s.statsName(c); ok {
+			if rating, games := s.PlayerStats.Rating(s.StatsServerAuthDomain, name); games > 0 {
+				return rating
+			}
+		}
+
+		for domain, a := range c.Authentications {
+			if a.name == "" {
+				continue
+			}
+			p, ok := s.PlayerStats.Get(domain, a.name)
+			if !ok {
+				continue
+			}
+			if g, ok := p.Modes[s.GameMode.ID().String()]; ok && g.Games > 0 && g.Frags > 0 {
+				return ratingFromRatio(g.KPD())
+			}
+		}
+	}
+
+	if avgFrags < 0 {
+		avgFrags = 0
+	}
+	return ratingFromRatio((float64(c.Frags) + 1) / (avgFrags + 1))
+}
+
+// Puts all clients into teams so that the total skill of the teams is as equal as possible, keeping players locked
+// into a team (by a master using /setteam) in that team. Spectators are put into teams like in TeamMode.Join.
+func (s *Server) shuffleTeamsBySkill(teamMode game.TeamMode) {
+	var players, spectators []*Client
+	s.Clients.ForEach(func(c *Client) {
+		if c.State == playerstate.Spectator {
+			spectators = append(spectators, c)
+		} else {
+			players = append(players, c)
+		}
+	})
+
+	teamNames := make([]string, 0, len(teamMode.Teams()))
+	for name := range teamMode.Teams() {
+		teamNames = append(teamNames, name)
+	}
+	if len(teamNames) == 0 {
+		s.ForEachPlayer(teamMode.Join)
+		return
+	}
+	sort.Strings(teamNames)
+
+	skills := s.skills(players)
+	members := partitionBySkill(teamNames, players, skills)
+
+	var totals []string
+	for _, name := range teamNames {
+		total := 0.0
+		for _, c := range members[name] {
+			teamMode.Rejoin(&c.Player, name)
+			total += skills[c]
+		}
+		if len(members[name]) > 0 {
+			totals = append(totals, fmt.Sprintf("%s %.0f", name, total/float64(len(members[name]))))
+		}
+	}
+	for _, c := range spectators {
+		teamMode.Join(&c.Player)
+	}
+
+	log.Printf("teams shuffled by skill (average ratings: %s)", strings.Join(totals, ", "))
+}
+
+// Splits the players into the named teams so that the total skill of the teams is as equal as possible. Locked
+// players stay in their team.
+func partitionBySkill(teamNames []string, players []*Client, skills map[*Client]float64) map[string][]*Client {
+	teams := append([]string{}, teamNames...)
+	members := map[string][]*Client{}
+	total := map[string]float64{}
+	assign := func(c *Client, team string) {
+		members[team] = append(members[team], c)
+		total[team] += skills[c]
+	}
+
+	// locked players stay in their team
+	var unlocked []*Client
+	for _, c := range players {
+		if c.TeamLocked && containsString(teams, c.Team.Name) {
+			assign(c, c.Team.Name)
+		} else {
+			unlocked = append(unlocked, c)
+		}
+	}
+
+	// best players first, each into the smallest team, or the weakest of the smallest teams
+	sort.SliceStable(unlocked, func(i, j int) bool { return skills[unlocked[i]] > skills[unlocked[j]] })
+	for _, c := range unlocked {
+		best := teams[0]
+		for _, t := range teams[1:] {
+			if len(members[t]) < len(members[best]) || (len(members[t]) == len(members[best]) && total[t] < total[best]) {
+				best = t
+			}
+		}
+		assign(c, best)
+	}
+
+	// swap unlocked players between the strongest and the weakest team while that makes the teams more even
+	for improved := true; improved && len(teams) > 1; {
+		improved = false
+		sort.SliceStable(teams, func(i, j int) bool { return total[teams[i]] > total[teams[j]] })
+		strong, weak := teams[0], teams[len(teams)-1]
+		diff := total[strong] - total[weak]
+		for i, a := range members[strong] {
+			for j, b := range members[weak] {
+				if a.TeamLocked || b.TeamLocked {
+					continue
+				}
+				delta := skills[a] - skills[b]
+				if delta > 0 && math.Abs(diff-2*delta) < diff {
+					members[strong][i], members[weak][j] = b, a
+					total[strong] -= delta
+					total[weak] += delta
+					improved = true
+					break
+				}
+			}
+			if improved {
+				break
+			}
+		}
+	}
+
+	return members
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
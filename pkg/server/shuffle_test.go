@@ -0,0 +1,80 @@
+package server
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sauerbraten/waiter/pkg/game"
+)
+
+func newTestClients(frags ...int) []*Client {
+	clients := make([]*Client, 0, len(frags))
+	for i, f := range frags {
+		c := NewClient(uint32(i), nil)
+		c.Frags = f
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func teamOf(members map[string][]*Client, c *Client) string {
+	for name, cs := range members {
+		for _, _c := range cs {
+			if _c == c {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func TestShuffleBySkillWithNegativeFrags(t *testing.T) {
+	s := &Server{}
+	players := newTestClients(-3, -1, 0, 10, 5, -7)
+
+	skills := s.skills(players)
+	for _, c := range players {
+		if math.IsNaN(skills[c]) || math.IsInf(skills[c], 0) {
+			t.Errorf("skill of player with %d frags is %f", c.Frags, skills[c])
+		}
+	}
+
+	members := partitionBySkill([]string{"evil", "good"}, players, skills)
+	if len(members["good"]) != 3 || len(members["evil"]) != 3 {
+		t.Errorf("teams have %d and %d players, expected 3 each", len(members["good"]), len(members["evil"]))
+	}
+
+	total := func(team string) (sum float64) {
+		for _, c := range members[team] {
+			sum += skills[c]
+		}
+		return
+	}
+	diff := math.Abs(total("good") - total("evil"))
+	if math.IsNaN(diff) || diff > skills[players[3]]-skills[players[5]] {
+		t.Errorf("teams differ in skill by %f", diff)
+	}
+}
+
+func TestShuffleBySkillKeepsLockedPlayers(t *testing.T) {
+	s := &Server{}
+	players := newTestClients(20, 15, 1, 0)
+	good := game.NewTeam("good")
+	for _, c := range players[:2] {
+		good.Add(&c.Player)
+		c.TeamLocked = true
+	}
+
+	members := partitionBySkill([]string{"evil", "good"}, players, s.skills(players))
+
+	for _, c := range players[:2] {
+		if team := teamOf(members, c); team != "good" {
+			t.Errorf("locked player with %d frags was put into team %q", c.Frags, team)
+		}
+	}
+	for _, c := range players[2:] {
+		if team := teamOf(members, c); team != "evil" {
+			t.Errorf("player with %d frags was put into team %q, expected evil", c.Frags, team)
+		}
+	}
+}
@@ -12,6 +12,7 @@ type State struct {
 	MasterMode mastermode.ID
 	GameMode   game.Mode
 	Map        string
+	MapCRC     uint32 // CRC of the current map's file, 0 if unknown
 	UpSince    time.Time
 	NumClients func() int // number of clients connected
 }
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sauerbraten/waiter/pkg/protocol/disconnectreason"
+	"github.com/sauerbraten/waiter/pkg/protocol/nmc"
+)
+
+// What to do with a client once it reached the configured number of violations.
+type ViolationAction string
+
+const (
+	LogViolation      ViolationAction = "log"  // only log violations
+	SpectateViolation ViolationAction = "spec" // force the client to spectate
+	KickViolation     ViolationAction = "kick" // kick the client
+)
+
+// one violation is forgiven per this much time without violations, so that occasional lag spikes don't add up over a
+// long session
+const violationDecay = 1 * time.Minute
+
+func (a ViolationAction) valid() bool {
+	switch a {
+	case LogViolation, SpectateViolation, KickViolation:
+		return true
+	default:
+		return false
+	}
+}
+
+// Violation is called when a client sent something that is impossible for an unmodified client, e.g. shooting faster
+// than the weapon reloads. Violations are logged and handled according to the configured policy.
+func (s *Server) Violation(c *Client, violation string) {
+	now := time.Now()
+	if c.Violations > 0 {
+		c.Violations -= int(now.Sub(c.LastViolation) / violationDecay)
+		if c.Violations < 0 {
+			c.Violations = 0
+		}
+	}
+	c.Violations++
+	c.LastViolation = now
+	log.Printf("violation #%d by %s: %s", c.Violations, c, violation)
+
+	if s.ViolationLimit <= 0 || c.Violations < s.ViolationLimit {
+		return
+	}
+
+	switch s.ViolationAction {
+	case SpectateViolation:
+		c.Violations = 0
+		if !c.Joined {
+			return
+		}
+		s.SetSpectator(c, true)
+		s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("%s was forced to spectate for violating game rules", s.Clients.UniqueName(c)))
+	case KickViolation:
+		s.Clients.Broadcast(nmc.ServerMessage, fmt.Sprintf("%s was kicked for violating game rules", s.Clients.UniqueName(c)))
+		s.Disconnect(c, disconnectreason.Kick)
+	}
+}
@@ -0,0 +1,55 @@
+package stats
+
+import "math"
+
+// Ratings are Elo ratings: a player rated 400 points higher than another is expected to win ten times as often.
+const (
+	DefaultRating = 1500.0
+
+	// maximum change of a player's rating after one game
+	ratingFactor = 32.0
+)
+
+// Expected returns the expected score (between 0 and 1) of a player rated a against a player rated b.
+func Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// RatingChange returns the change in rating of a player who scored actual (1 for a win, 0.5 for a draw, 0 for a loss)
+// in a game where expected was the expected score.
+func RatingChange(actual, expected float64) float64 {
+	return ratingFactor * (actual - expected)
+}
+
+// Rating returns the player's rating and the number of games it is based on. Players without rated games have the
+// default rating.
+func (s *Store) Rating(domain, name string) (float64, int) {
+	s.μ.Lock()
+	defer s.μ.Unlock()
+
+	p, ok := s.players[domain][name]
+	if !ok || p.RatedGames == 0 {
+		return DefaultRating, 0
+	}
+	return p.Rating, p.RatedGames
+}
+
+// AddRating changes the player's rating by delta and counts one more rated game.
+func (s *Store) AddRating(domain, name string, delta float64) {
+	s.μ.Lock()
+	defer s.μ.Unlock()
+
+	if s.players[domain] == nil {
+		s.players[domain] = map[string]*Player{}
+	}
+	p, ok := s.players[domain][name]
+	if !ok {
+		p = &Player{Modes: map[string]*Game{}}
+		s.players[domain][name] = p
+	}
+	if p.RatedGames == 0 {
+		p.Rating = DefaultRating
+	}
+	p.Rating += delta
+	p.RatedGames++
+}
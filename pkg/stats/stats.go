@@ -0,0 +1,209 @@
+// Package stats keeps lifetime statistics of authenticated players in a JSON file.
+package stats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Game holds the statistics of one player in one game, or the sum of several games.
+type Game struct {
+	Games           int   `json:"games"`
+	Wins            int   `json:"wins"`
+	Frags           int   `json:"frags"`
+	Deaths          int   `json:"deaths"`
+	Damage          int64 `json:"damage"`
+	DamagePotential int64 `json:"damage_potential"`
+	Flags           int   `json:"flags"`
+}
+
+func (g *Game) add(other Game) {
+	g.Games += other.Games
+	g.Wins += other.Wins
+	g.Frags += other.Frags
+	g.Deaths += other.Deaths
+	g.Damage += other.Damage
+	g.DamagePotential += other.DamagePotential
+	g.Flags += other.Flags
+}
+
+// Accuracy returns the percentage of the potential damage that was actually dealt.
+func (g *Game) Accuracy() float64 {
+	if g.DamagePotential <= 0 {
+		return 0
+	}
+	return float64(g.Damage) * 100 / float64(g.DamagePotential)
+}
+
+// KPD returns the kills per death, counting zero deaths as one.
+func (g *Game) KPD() float64 {
+	deaths := g.Deaths
+	if deaths < 1 {
+		deaths = 1
+	}
+	return float64(g.Frags) / float64(deaths)
+}
+
+// Player holds the lifetime statistics of a player, by game mode name.
+type Player struct {
+	Modes      map[string]*Game `json:"modes"`
+	LastSeen   time.Time        `json:"last_seen"`
+	Rating     float64          `json:"rating,omitempty"`
+	RatedGames int              `json:"rated_games,omitempty"`
+}
+
+// Total sums up the statistics of all modes.
+func (p *Player) Total() Game {
+	total := Game{}
+	for _, g := range p.Modes {
+		total.add(*g)
+	}
+	return total
+}
+
+// Store holds the statistics of players by auth domain and name. It is safe for concurrent use.
+type Store struct {
+	μ       sync.Mutex
+	path    string
+	players map[string]map[string]*Player // domain → name → stats
+}
+
+// Open loads the store from the file at path. If the file does not exist, the store starts out empty and the file is
+// created when the store is first saved.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		players: map[string]map[string]*Player{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &s.players)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Add adds the statistics of a game played in the given mode to the player's lifetime statistics.
+func (s *Store) Add(domain, name, mode string, g Game) {
+	s.μ.Lock()
+	defer s.μ.Unlock()
+
+	if s.players[domain] == nil {
+		s.players[domain] = map[string]*Player{}
+	}
+	p, ok := s.players[domain][name]
+	if !ok {
+		p = &Player{Modes: map[string]*Game{}}
+		s.players[domain][name] = p
+	}
+	if p.Modes[mode] == nil {
+		p.Modes[mode] = &Game{}
+	}
+	p.Modes[mode].add(g)
+	p.LastSeen = time.Now()
+}
+
+// Get returns a copy of the player's statistics.
+func (s *Store) Get(domain, name string) (Player, bool) {
+	s.μ.Lock()
+	defer s.μ.Unlock()
+
+	p, ok := s.players[domain][name]
+	if !ok {
+		return Player{}, false
+	}
+	return p.copy(), true
+}
+
+// Players returns a copy of the statistics of all players of a domain, by name.
+func (s *Store) Players(domain string) map[string]Player {
+	s.μ.Lock()
+	defer s.μ.Unlock()
+
+	players := map[string]Player{}
+	for name, p := range s.players[domain] {
+		players[name] = p.copy()
+	}
+	return players
+}
+
+// Entry is a player's position in a leaderboard.
+type Entry struct {
+	Name  string
+	Stats Game
+	Value float64
+}
+
+// Leaderboard ranks the players of a domain who played at least minGames games in the given mode by value, best
+// first. Players with equal values are ordered by name.
+func (s *Store) Leaderboard(domain, mode string, minGames int, value func(*Game) float64) []Entry {
+	s.μ.Lock()
+	defer s.μ.Unlock()
+
+	var entries []Entry
+	for name, p := range s.players[domain] {
+		g, ok := p.Modes[mode]
+		if !ok || g.Games < minGames {
+			continue
+		}
+		entries = append(entries, Entry{
+			Name:  name,
+			Stats: *g,
+			Value: value(g),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries
+}
+
+func (p *Player) copy() Player {
+	c := Player{
+		Modes:      map[string]*Game{},
+		LastSeen:   p.LastSeen,
+		Rating:     p.Rating,
+		RatedGames: p.RatedGames,
+	}
+	for mode, g := range p.Modes {
+		_g := *g
+		c.Modes[mode] = &_g
+	}
+	return c
+}
+
+// Save writes the store to its file. The file is replaced atomically, so a crash while saving doesn't lose the
+// previously saved statistics.
+func (s *Store) Save() error {
+	s.μ.Lock()
+	defer s.μ.Unlock()
+
+	data, err := json.MarshalIndent(s.players, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}